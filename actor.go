@@ -19,14 +19,17 @@ type Actor interface {
 	// Also sometimes useful to override.
 	Bounds() pixel.Rect
 	ScaledBounds() pixel.Rect
-	// TODO: CollisionPolygon?
+	// Implement CollisionPolygoner for a tighter fit than Bounds.
 
 	// Needed by Stage.
 	Kind() string
 	Position() pixel.Vec
 	Scale() float64
 	Rotation() float64
+	Velocity() pixel.Vec
 	Transform() pixel.Matrix
+	Tags() []string
+	actorHandle() *ActorHandle
 }
 
 // BaseActor implements Actor and is expected to embedded in richer Actors.
@@ -39,12 +42,28 @@ type BaseActor struct {
 	scale            float64
 	velocity         pixel.Vec
 	rotationVelocity float64
+	tags             []string
+	handle           ActorHandle // Set by Stage.AddActor.
 	// TODO: a way to control ordering such that e.g. text is can always be on top
 	// layer int
 }
 
 var nextID = 1
 
+// kindTags are the tags every Actor of a kind starts with.
+var kindTags = map[string][]string{
+	"rock":        {"enemy"},
+	"ship":        {"player"},
+	"shot":        {"projectile"},
+	"missile":     {"projectile"},
+	"beam":        {"projectile"},
+	"powerUp":     {"pickup"},
+	"text":        {"hud"},
+	"lives":       {"hud"},
+	"shieldMeter": {"hud"},
+	"debris":      {"effect"},
+}
+
 func MakeBaseActor(stage *Stage, kind string) BaseActor {
 	return BaseActor{
 		stage:            stage,
@@ -53,13 +72,37 @@ func MakeBaseActor(stage *Stage, kind string) BaseActor {
 		rotation:         0.0,
 		velocity:         pixel.ZV,
 		rotationVelocity: 0.0,
-		kind:             kind}
+		kind:             kind,
+		tags:             kindTags[kind]}
 }
 
 func (a *BaseActor) Kind() string {
 	return a.kind
 }
 
+func (a *BaseActor) Tags() []string {
+	return a.tags
+}
+
+// Tag gives the Actor more tags.
+func (a *BaseActor) Tag(tags ...string) {
+	for _, tag := range tags {
+		if hasTag(a, tag) {
+			continue
+		}
+		// The tags may be shared with kindTags, so never append to them in place.
+		a.tags = append(a.tags[:len(a.tags):len(a.tags)], tag)
+
+		// The Stage holds the Actor this BaseActor is embedded in, which shares its handle.
+		if a.stage == nil {
+			continue
+		}
+		if actor := a.stage.Get(a.handle); actor != nil && actor.actorHandle() == &a.handle {
+			a.stage.indexTags(actor, []string{tag})
+		}
+	}
+}
+
 func (a *BaseActor) Position() pixel.Vec {
 	return a.position
 }
@@ -72,8 +115,15 @@ func (a *BaseActor) Rotation() float64 {
 	return a.rotation
 }
 
+func (a *BaseActor) Velocity() pixel.Vec {
+	return a.velocity
+}
+
+// Transform returns the Actor's transform in Stage coordinates. Its position, rotation and scale are
+// relative to its parent, if it has one.
 func (a *BaseActor) Transform() pixel.Matrix {
-	return pixel.IM.Scaled(pixel.ZV, a.scale).Rotated(pixel.ZV, a.rotation).Moved(a.position)
+	local := pixel.IM.Scaled(pixel.ZV, a.scale).Rotated(pixel.ZV, a.rotation).Moved(a.position)
+	return a.stage.worldTransform(a.handle, local)
 }
 
 func (a *BaseActor) Bounds() pixel.Rect {
@@ -84,6 +134,15 @@ func (a *BaseActor) ScaledBounds() pixel.Rect {
 	return pixel.Rect{Min: a.position, Max: a.position}
 }
 
+func (a *BaseActor) actorHandle() *ActorHandle {
+	return &a.handle
+}
+
+// baseActor gives access to the BaseActor embedded in any Actor.
+func (a *BaseActor) baseActor() *BaseActor {
+	return a
+}
+
 func (a *BaseActor) Update(dt float64) {
 	// TODO: dt
 	a.position = a.position.Add(a.velocity)
@@ -173,19 +232,62 @@ func (a *TextActor) Draw() {
 
 //
 
+// hasTag reports whether the Actor has the tag.
+func hasTag(actor Actor, tag string) bool {
+	for _, t := range actor.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// CollisionPolygoner is optionally implemented by Actors whose shape isn't well described by their Bounds.
+type CollisionPolygoner interface {
+	// CollisionPolygon returns a convex polygon in the Actor's local (untransformed) coordinates.
+	CollisionPolygon() Polygon
+}
+
+// AddListener is optionally implemented by Actors that want to know when they join a Stage.
+type AddListener interface {
+	// OnAdded is called once the Actor is on the Stage.
+	OnAdded()
+}
+
+// RemoveListener is optionally implemented by Actors that want to know when they leave a Stage, e.g.
+// to leave an explosion behind. They aren't told when the Stage is Reset.
+type RemoveListener interface {
+	// OnRemoved is called once the Actor has left the Stage.
+	OnRemoved()
+}
+
+// CollisionListener is optionally implemented by Actors that want the Stage to check what they touch.
+type CollisionListener interface {
+	// OnCollide is called after every Actor has been updated, for each other Actor whose collision
+	// polygon intersects this one's.
+	OnCollide(other Actor)
+}
+
+// collisionPolygon returns the Actor's collision polygon projected into Stage coordinates.
+func collisionPolygon(a Actor) Polygon {
+	var polygon Polygon
+	if c, ok := a.(CollisionPolygoner); ok {
+		polygon = c.CollisionPolygon()
+	} else {
+		polygon = polygonFromRect(a.Bounds())
+	}
+	transform := a.Transform()
+	return projectPolygon(&polygon, &transform)
+}
+
 func intersects(a Actor, b Actor) bool {
 	// No self-colliding.
 	if a == b {
 		return false
 	}
 
-	// TODO: seems excessively verbose
-	aTransform := a.Transform()
-	bTransform := b.Transform()
-	aPolygon := polygonFromRect(a.Bounds())
-	bPolygon := polygonFromRect(b.Bounds())
-	aPolygon = projectPolygon(&aPolygon, &aTransform)
-	bPolygon = projectPolygon(&bPolygon, &bTransform)
+	aPolygon := collisionPolygon(a)
+	bPolygon := collisionPolygon(b)
 	return polygonsIntersect(&aPolygon, &bPolygon)
 }
 
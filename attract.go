@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// GameState is what the Game is showing. Between games it cycles, like an arcade cabinet's attract
+// mode, through the title, the high scores and a demo, until the player starts a game.
+type GameState int
+
+const (
+	PlayingState    GameState = iota // The player's game.
+	TitleState                       // Press 1, 2 or 3 to play.
+	HighScoresState                  // The high-score table.
+	DemoState                        // A game played by the autopilot.
+)
+
+// How long each attract screen is shown, in seconds. The demo ends sooner if the autopilot loses.
+const (
+	titleLength      = 8.0
+	highScoresLength = 6.0
+	demoLength       = 30.0
+)
+
+// startGame starts a new game for the given number of players, taking turns or in co-op. In DemoState
+// the autopilot plays it.
+func (g *Game) startGame(state GameState, players int, coop bool) {
+	g.state = state
+	g.numberOfPlayers = players
+	g.coop = coop
+	g.attractTimer = demoLength
+	g.reset()
+}
+
+// showTitle shows the title screen, with a few rocks drifting behind it.
+func (g *Game) showTitle() {
+	g.state = TitleState
+	g.attractTimer = titleLength
+	g.stage.Reset()
+	g.audio.StopAll()
+
+	g.levelParams = levelParams(1)
+	for i := 0; i < g.levelParams.rocks; i++ {
+		makeRock(g, 1, nil)
+	}
+
+	makeAttractText(g, pixel.V(0, 120), 5, "GO ROCKS!")
+	makeAttractText(g, pixel.V(0, -120), 2, "PRESS 1 FOR ONE PLAYER\nPRESS 2 FOR TWO PLAYERS\nPRESS 3 FOR CO-OP")
+	if len(g.highScores) > 0 {
+		makeAttractText(g, pixel.V(0, g.stage.bounds.Max.Y-30), 2, fmt.Sprintf("HIGH SCORE %v", g.highScores[0].score))
+	}
+}
+
+// showHighScores shows the high-score table.
+func (g *Game) showHighScores() {
+	g.state = HighScoresState
+	g.attractTimer = highScoresLength
+	g.stage.Reset()
+	g.audio.StopAll()
+
+	makeAttractText(g, pixel.V(0, 220), 3, "HIGH SCORES")
+	makeAttractText(g, pixel.V(0, 140), 2, g.formatHighScores())
+}
+
+// updateAttract moves on to the next attract screen when the current one's time is up. A key press
+// returns to the title. On the title 1 (or enter) or 2 starts a game for that many players, and 3
+// a co-op game for coopPlayers.
+func (g *Game) updateAttract(dt float64) {
+	if win := g.stage.win; win != nil {
+		if g.state == TitleState {
+			if win.JustPressed(pixelgl.Key1) || win.JustPressed(pixelgl.KeyEnter) || win.JustPressed(pixelgl.KeyKPEnter) {
+				g.startGame(PlayingState, 1, false)
+				return
+			}
+			if win.JustPressed(pixelgl.Key2) {
+				g.startGame(PlayingState, 2, false)
+				return
+			}
+			if win.JustPressed(pixelgl.Key3) {
+				g.startGame(PlayingState, g.coopPlayers, true)
+				return
+			}
+		}
+		if g.state != TitleState && anyKeyJustPressed(win) {
+			g.showTitle()
+			return
+		}
+	}
+
+	g.attractTimer -= dt
+	if g.attractTimer > 0 {
+		return
+	}
+	switch g.state {
+	case TitleState:
+		g.showHighScores()
+	case HighScoresState:
+		g.startGame(DemoState, 1, false)
+	case DemoState:
+		g.showTitle()
+	}
+}
+
+// makeAttractText shows centered text on an attract screen.
+func makeAttractText(game *Game, position pixel.Vec, scale float64, text string) *TextActor {
+	t := MakeTextActor(position, game.stage)
+	t.scale = scale
+	t.horizontalAlignment = "center"
+	t.SetText(text)
+
+	game.stage.AddActor(&t)
+	return &t
+}
+
+// makeDemoBanner labels the demo so it isn't mistaken for a game in progress.
+func makeDemoBanner(game *Game) *TextActor {
+	return makeAttractText(game, pixel.V(0, game.stage.bounds.Min.Y+40), 2, "DEMO - PRESS ANY KEY")
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"massena.com/gorocks/synth"
+)
+
+// AudioChannel groups sounds so their volume can be adjusted together.
+type AudioChannel int
+
+const (
+	EffectsChannel AudioChannel = iota // Shots, explosions, extra lives.
+	AmbientChannel                     // Looping sounds like the ship's thrust.
+	BeatChannel                        // The heartbeat.
+	numAudioChannels
+)
+
+// AudioBackend decodes and plays sounds. The Audio manager handles everything else.
+type AudioBackend interface {
+	// Load decodes a WAV or OGG file into a clip ready for playback.
+	Load(path string) (AudioClip, error)
+	// LoadSamples turns mono PCM samples (-1..1) into a clip ready for playback.
+	LoadSamples(samples []float64, sampleRate int) (AudioClip, error)
+	// Play starts playing a clip at the given volume (0..1), optionally looping it forever.
+	Play(clip AudioClip, volume float64, loop bool) AudioVoice
+}
+
+// AudioClip is a decoded sound. Its contents are up to the AudioBackend.
+type AudioClip interface{}
+
+// AudioVoice is a playing instance of an AudioClip.
+type AudioVoice interface {
+	Stop()
+	SetVolume(volume float64)
+}
+
+type audioClipInfo struct {
+	clip    AudioClip
+	channel AudioChannel
+}
+
+// Audio loads, plays, and loops named sounds on top of an AudioBackend.
+type Audio struct {
+	backend  AudioBackend
+	clips    map[string]audioClipInfo
+	loops    map[string]AudioVoice
+	volumes  [numAudioChannels]float64
+	muted    bool
+	silenced bool // Play does nothing, e.g. while re-simulating what has already been heard.
+}
+
+// MakeAudio creates an Audio manager. Pass nullAudioBackend{} to run without sound.
+func MakeAudio(backend AudioBackend) Audio {
+	a := Audio{backend: backend, clips: make(map[string]audioClipInfo), loops: make(map[string]AudioVoice)}
+	for i := range a.volumes {
+		a.volumes[i] = 1
+	}
+	return a
+}
+
+// Load decodes the sound at path and makes it playable by name on the given channel.
+func (a *Audio) Load(name string, path string, channel AudioChannel) error {
+	clip, err := a.backend.Load(path)
+	if err != nil {
+		return fmt.Errorf("loading sound %q: %w", name, err)
+	}
+	a.clips[name] = audioClipInfo{clip: clip, channel: channel}
+	return nil
+}
+
+// LoadSynth synthesizes a sound and makes it playable by name on the given channel.
+func (a *Audio) LoadSynth(name string, params synth.Params, channel AudioChannel) error {
+	clip, err := a.backend.LoadSamples(synth.Generate(params, synthSampleRate), synthSampleRate)
+	if err != nil {
+		return fmt.Errorf("synthesizing sound %q: %w", name, err)
+	}
+	a.clips[name] = audioClipInfo{clip: clip, channel: channel}
+	return nil
+}
+
+// LoadSounds synthesizes every sound in gameSounds. Failures are logged, not fatal, and
+// those sounds simply won't play.
+func (a *Audio) LoadSounds() {
+	for _, sound := range gameSounds {
+		if err := a.LoadSynth(sound.name, sound.params, sound.channel); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// Play the named sound once. Unknown names are ignored.
+func (a *Audio) Play(name string) {
+	info, ok := a.clips[name]
+	if !ok || a.silenced {
+		return
+	}
+	a.backend.Play(info.clip, a.volume(info.channel), false)
+}
+
+// Loop plays the named sound repeatedly until Stop is called. Looping an already looping
+// sound does nothing.
+func (a *Audio) Loop(name string) {
+	info, ok := a.clips[name]
+	if !ok || a.loops[name] != nil {
+		return
+	}
+	a.loops[name] = a.backend.Play(info.clip, a.volume(info.channel), true)
+}
+
+// Stop a looping sound.
+func (a *Audio) Stop(name string) {
+	if voice := a.loops[name]; voice != nil {
+		voice.Stop()
+		delete(a.loops, name)
+	}
+}
+
+// StopAll stops every looping sound.
+func (a *Audio) StopAll() {
+	for name := range a.loops {
+		a.Stop(name)
+	}
+}
+
+// SetVolume sets a channel's volume (0..1). Looping sounds are adjusted immediately.
+func (a *Audio) SetVolume(channel AudioChannel, volume float64) {
+	a.volumes[channel] = volume
+	a.updateLoopVolumes()
+}
+
+// Volume returns a channel's volume (0..1), ignoring muting.
+func (a *Audio) Volume(channel AudioChannel) float64 {
+	return a.volumes[channel]
+}
+
+// SetMuted silences (or restores) all sound without forgetting the channel volumes.
+func (a *Audio) SetMuted(muted bool) {
+	a.muted = muted
+	a.updateLoopVolumes()
+}
+
+func (a *Audio) Muted() bool {
+	return a.muted
+}
+
+// SubscribeTo plays the game's sounds in response to its events.
+func (a *Audio) SubscribeTo(events *EventBus) {
+	events.OnShotFired(func(ShotFired) {
+		a.Play("fire")
+	})
+	events.OnShipThrust(func(e ShipThrust) {
+		if e.Thrusting {
+			a.Loop("thrust")
+		} else {
+			a.Stop("thrust")
+		}
+	})
+	events.OnShipDestroyed(func(ShipDestroyed) {
+		a.Stop("thrust")
+		a.Play("explodeLarge")
+	})
+	events.OnRockDestroyed(func(e RockDestroyed) {
+		a.Play([]string{"explodeLarge", "explodeMedium", "explodeSmall"}[e.Rock.generation-1])
+	})
+	events.OnExtraLife(func(ExtraLife) {
+		a.Play("extraLife")
+	})
+	events.OnPowerUpCollected(func(PowerUpCollected) {
+		a.Play("powerUp")
+	})
+}
+
+func (a *Audio) volume(channel AudioChannel) float64 {
+	if a.muted {
+		return 0
+	}
+	return a.volumes[channel]
+}
+
+func (a *Audio) updateLoopVolumes() {
+	for name, voice := range a.loops {
+		voice.SetVolume(a.volume(a.clips[name].channel))
+	}
+}
+
+// Heartbeat alternates between two low tones, speeding up as its intensity rises.
+type Heartbeat struct {
+	audio    *Audio
+	slowest  float64 // Seconds between beats at intensity 0.
+	fastest  float64 // Seconds between beats at intensity 1.
+	timer    float64
+	highTone bool
+}
+
+func makeHeartbeat(audio *Audio) Heartbeat {
+	return Heartbeat{audio: audio, slowest: 1.0, fastest: 0.25}
+}
+
+// Reset the Heartbeat so the next Update starts from the low tone after a full pause.
+func (h *Heartbeat) Reset() {
+	h.timer = h.slowest
+	h.highTone = false
+}
+
+// Update advances the Heartbeat. intensity ranges from 0 (slowest) to 1 (fastest).
+func (h *Heartbeat) Update(dt float64, intensity float64) {
+	h.timer -= dt
+	if h.timer > 0 {
+		return
+	}
+
+	if h.highTone {
+		h.audio.Play("beatHigh")
+	} else {
+		h.audio.Play("beatLow")
+	}
+	h.highTone = !h.highTone
+	h.timer = h.slowest + (h.fastest-h.slowest)*intensity
+}
+
+const synthSampleRate = 44100
+
+// gameSounds lists the sounds LoadSounds synthesizes.
+var gameSounds = []struct {
+	name    string
+	params  synth.Params
+	channel AudioChannel
+}{
+	{"fire", synth.Laser, EffectsChannel},
+	{"explodeLarge", synth.ExplosionLarge, EffectsChannel},
+	{"explodeMedium", synth.ExplosionMedium, EffectsChannel},
+	{"explodeSmall", synth.ExplosionSmall, EffectsChannel},
+	{"extraLife", synth.ExtraLife, EffectsChannel},
+	{"powerUp", synth.PowerUp, EffectsChannel},
+	{"thrust", synth.Thrust, AmbientChannel},
+	{"saucer", synth.SaucerSiren, AmbientChannel},
+	{"beatLow", synth.ThumpLow, BeatChannel},
+	{"beatHigh", synth.ThumpHigh, BeatChannel},
+}
+
+// nullAudioBackend accepts everything and plays nothing. Useful when headless or without a sound device.
+type nullAudioBackend struct{}
+
+func (nullAudioBackend) Load(path string) (AudioClip, error) {
+	return nil, nil
+}
+
+func (nullAudioBackend) LoadSamples(samples []float64, sampleRate int) (AudioClip, error) {
+	return nil, nil
+}
+
+func (nullAudioBackend) Play(clip AudioClip, volume float64, loop bool) AudioVoice {
+	return nullAudioVoice{}
+}
+
+type nullAudioVoice struct{}
+
+func (nullAudioVoice) Stop()                    {}
+func (nullAudioVoice) SetVolume(volume float64) {}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNullAudio(t *testing.T) {
+	audio := MakeAudio(nullAudioBackend{})
+	audio.LoadSounds()
+	for _, sound := range gameSounds {
+		if _, ok := audio.clips[sound.name]; !ok {
+			t.Errorf("sound %q wasn't loaded", sound.name)
+		}
+	}
+
+	audio.Play("fire")
+	audio.Play("no such sound")
+
+	audio.Loop("thrust")
+	audio.Loop("saucer")
+	audio.Loop("thrust")
+	audio.Loop("no such sound")
+	if len(audio.loops) != 2 || audio.loops["thrust"] == nil || audio.loops["saucer"] == nil {
+		t.Errorf("looping %v, want thrust and saucer", audio.loops)
+	}
+
+	audio.SetVolume(AmbientChannel, 0.5)
+	audio.SetMuted(true)
+	if !audio.Muted() || audio.volume(AmbientChannel) != 0 || audio.Volume(AmbientChannel) != 0.5 {
+		t.Errorf("muted %v, volume %v, set volume %v", audio.Muted(), audio.volume(AmbientChannel), audio.Volume(AmbientChannel))
+	}
+	audio.SetMuted(false)
+	if audio.volume(AmbientChannel) != 0.5 {
+		t.Errorf("volume %v after unmuting, want 0.5", audio.volume(AmbientChannel))
+	}
+
+	audio.Stop("thrust")
+	audio.Stop("thrust")
+	if _, ok := audio.loops["thrust"]; ok || len(audio.loops) != 1 {
+		t.Errorf("looping %v after stopping thrust", audio.loops)
+	}
+	audio.StopAll()
+	if len(audio.loops) != 0 {
+		t.Errorf("looping %v after stopping everything", audio.loops)
+	}
+}
+
+func TestAudioEvents(t *testing.T) {
+	backend := &countingAudioBackend{}
+	audio := MakeAudio(backend)
+	audio.LoadSounds()
+	var events EventBus
+	audio.SubscribeTo(&events)
+
+	events.PublishShipThrust(ShipThrust{Thrusting: true})
+	if audio.loops["thrust"] == nil {
+		t.Error("thrusting didn't loop the thrust")
+	}
+	events.PublishShipDestroyed(ShipDestroyed{})
+	if audio.loops["thrust"] != nil {
+		t.Error("the thrust kept looping after the ship was destroyed")
+	}
+
+	played := len(backend.played)
+	events.PublishShotFired(ShotFired{})
+	if want := []AudioClip{audio.clips["fire"].clip}; !reflect.DeepEqual(backend.played[played:], want) {
+		t.Errorf("firing played %v, want %v", backend.played[played:], want)
+	}
+
+	// The heartbeat starts at once with the low tone, then alternates every 0.625 seconds at intensity 0.5.
+	played = len(backend.played)
+	heartbeat := makeHeartbeat(&audio)
+	for i := 0; i < 120; i++ {
+		heartbeat.Update(1.0/60, 0.5)
+	}
+	low, high := audio.clips["beatLow"].clip, audio.clips["beatHigh"].clip
+	if want := []AudioClip{low, high, low, high}; !reflect.DeepEqual(backend.played[played:], want) {
+		t.Errorf("the heartbeat played %v, want %v", backend.played[played:], want)
+	}
+}
+
+// countingAudioBackend numbers the clips it loads and records the clips it plays.
+type countingAudioBackend struct {
+	nullAudioBackend
+	clips  int
+	played []AudioClip
+}
+
+func (b *countingAudioBackend) LoadSamples(samples []float64, sampleRate int) (AudioClip, error) {
+	b.clips++
+	return b.clips, nil
+}
+
+func (b *countingAudioBackend) Play(clip AudioClip, volume float64, loop bool) AudioVoice {
+	b.played = append(b.played, clip)
+	return nullAudioVoice{}
+}
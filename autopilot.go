@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// Autopilot is a Controller that plays the game. It dodges the most pressing Rock, escaping with the
+// Ship's special when a collision can't be avoided, and otherwise shoots the Rock that is easiest to hit.
+// Like velocities, its times are in frames.
+type Autopilot struct {
+	dangerTime   float64 // A Rock that will hit the Ship within this many frames is dodged.
+	panicTime    float64 // A Rock that will hit within this many frames can only be escaped with the special.
+	safetyMargin float64 // Extra pixels of clearance to keep from Rocks.
+	shotSpeed    float64 // Speed of a Shot relative to the Ship. See fireShot.
+	shotRange    float64 // Frames a Shot lasts.
+	aimTolerance float64 // Radians off the lead angle the Ship still fires at.
+	cruiseSpeed  float64 // Top speed relative to a Rock out of range when closing in on it.
+}
+
+func makeAutopilot() *Autopilot {
+	return &Autopilot{dangerTime: 45, panicTime: 8, safetyMargin: 10, shotSpeed: 5, shotRange: 80, aimTolerance: 0.1,
+		cruiseSpeed: 1.5}
+}
+
+// enemies are what the autopilot avoids and shoots at.
+var enemies = mustParseQuery("enemy")
+
+// threat is a Rock on course to hit the Ship.
+type threat struct {
+	rock    Actor
+	time    float64   // Frames until the closest approach.
+	miss    pixel.Vec // Where the Rock will be at the closest approach, relative to the Ship.
+	contact float64   // Distance at which the Rock touches the Ship.
+}
+
+func (a *Autopilot) Actions(ship *Ship) Actions {
+	if t := a.worstThreat(ship); t != nil {
+		return a.evade(ship, t)
+	}
+	return a.attack(ship)
+}
+
+// worstThreat returns the Rock that will hit the Ship soonest, or nil if none will within dangerTime.
+func (a *Autopilot) worstThreat(ship *Ship) *threat {
+	var worst *threat
+	shipRadius := actorRadius(ship)
+	for it := ship.stage.Query(enemies); it.Next(); {
+		rock := it.Actor()
+		position := wrapDelta(ship.stage.WorldPosition(rock).Sub(ship.position), ship.stage.bounds)
+		velocity := rock.Velocity().Sub(ship.velocity)
+
+		time := 0.0
+		if speed := velocity.Dot(velocity); speed > 0 {
+			time = math.Max(0, -position.Dot(velocity)/speed)
+		}
+		miss := position.Add(velocity.Scaled(time))
+		contact := shipRadius + actorRadius(rock) + a.safetyMargin
+		if time > a.dangerTime || miss.Len() > contact {
+			continue
+		}
+		if worst == nil || time < worst.time {
+			worst = &threat{rock: rock, time: time, miss: miss, contact: contact}
+		}
+	}
+	return worst
+}
+
+// evade turns away from the threat's path and thrusts. If it is too close for that to work the
+// special is used: shields are raised, or as a last resort the Ship jumps into hyperspace.
+func (a *Autopilot) evade(ship *Ship, t *threat) Actions {
+	if t.time < a.panicTime {
+		switch ship.game.special {
+		case ShieldSpecial:
+			if ship.player.shieldEnergy > 0 {
+				return Special
+			}
+		case HyperspaceSpecial:
+			if t.miss.Len() < t.contact-a.safetyMargin {
+				return Special
+			}
+		}
+	}
+
+	// Head away from where the Rock will be. If it's coming straight at the Ship, sidestep its path.
+	away := t.miss.Scaled(-1)
+	if away.Len() < 1 {
+		away = t.rock.Velocity().Sub(ship.velocity).Normal()
+	}
+	actions := a.turnToward(ship, away.Angle(), 0.5)
+	if math.Abs(a.headingError(ship, away.Angle())) < math.Pi/2 {
+		actions |= Thrust
+	}
+	return actions
+}
+
+// attack aims at the Rock needing the least turning to hit, leading it by its velocity, and fires once on target.
+// If no Rock is within range it slowly closes in on the nearest.
+func (a *Autopilot) attack(ship *Ship) Actions {
+	bestAngle := 0.0
+	bestCost := math.MaxFloat64
+	var nearest, nearestVelocity pixel.Vec
+	for it := ship.stage.Query(enemies); it.Next(); {
+		rock := it.Actor()
+		position := wrapDelta(ship.stage.WorldPosition(rock).Sub(ship.position), ship.stage.bounds)
+		if nearest == pixel.ZV || position.Len() < nearest.Len() {
+			nearest = position
+			nearestVelocity = rock.Velocity()
+		}
+		time, ok := a.interceptTime(position, rock.Velocity().Sub(ship.velocity))
+		if !ok || time > a.shotRange {
+			continue
+		}
+		aim := position.Add(rock.Velocity().Sub(ship.velocity).Scaled(time))
+		cost := math.Abs(a.headingError(ship, aim.Angle())) + time/a.shotRange
+		if cost < bestCost {
+			bestAngle = aim.Angle()
+			bestCost = cost
+		}
+	}
+	if bestCost == math.MaxFloat64 {
+		if nearest == pixel.ZV {
+			return 0
+		}
+		actions := a.turnToward(ship, nearest.Angle(), a.aimTolerance/2)
+		closing := ship.velocity.Sub(nearestVelocity).Dot(nearest.Unit())
+		if math.Abs(a.headingError(ship, nearest.Angle())) < a.aimTolerance && closing < a.cruiseSpeed {
+			actions |= Thrust
+		}
+		return actions
+	}
+
+	actions := a.turnToward(ship, bestAngle, a.aimTolerance/2)
+	if math.Abs(a.headingError(ship, bestAngle)) < a.aimTolerance {
+		actions |= Fire
+	}
+	return actions
+}
+
+// interceptTime returns how many frames a Shot fired now takes to hit a Rock at position moving at
+// velocity, both relative to the Ship. It solves |position + velocity*t| = shotSpeed*t for the
+// smallest positive t.
+func (a *Autopilot) interceptTime(position pixel.Vec, velocity pixel.Vec) (float64, bool) {
+	qa := velocity.Dot(velocity) - a.shotSpeed*a.shotSpeed
+	qb := 2 * position.Dot(velocity)
+	qc := position.Dot(position)
+
+	if math.Abs(qa) < 1e-9 {
+		if qb >= 0 {
+			return 0, false
+		}
+		return -qc / qb, true
+	}
+
+	discriminant := qb*qb - 4*qa*qc
+	if discriminant < 0 {
+		return 0, false
+	}
+	root := math.Sqrt(discriminant)
+	t1 := (-qb - root) / (2 * qa)
+	t2 := (-qb + root) / (2 * qa)
+	if t1 > t2 {
+		t1, t2 = t2, t1
+	}
+	switch {
+	case t1 > 0:
+		return t1, true
+	case t2 > 0:
+		return t2, true
+	}
+	return 0, false
+}
+
+// headingError returns the signed angle the Ship must turn, counter-clockwise positive, to face angle.
+func (a *Autopilot) headingError(ship *Ship, angle float64) float64 {
+	return math.Remainder(angle-(ship.rotation+math.Pi/2), math.Pi*2)
+}
+
+// turnToward returns the turn Action toward angle, or none if already within tolerance of it.
+func (a *Autopilot) turnToward(ship *Ship, angle float64, tolerance float64) Actions {
+	turn := a.headingError(ship, angle)
+	switch {
+	case turn > tolerance:
+		return TurnLeft
+	case turn < -tolerance:
+		return TurnRight
+	}
+	return 0
+}
+
+// actorRadius approximates the Actor as a circle enclosing its scaled bounds.
+func actorRadius(actor Actor) float64 {
+	bounds := actor.ScaledBounds()
+	return math.Max(bounds.W(), bounds.H()) / 2
+}
+
+// wrapDelta returns the shortest offset equivalent to delta on a Stage whose edges wrap around.
+func wrapDelta(delta pixel.Vec, bounds pixel.Rect) pixel.Vec {
+	return pixel.V(math.Remainder(delta.X, bounds.W()), math.Remainder(delta.Y, bounds.H()))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+	"github.com/faiface/beep/speaker"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+)
+
+// beepAudioBackend plays sounds through the system speaker using faiface/beep.
+type beepAudioBackend struct {
+	sampleRate beep.SampleRate
+}
+
+// newBeepAudioBackend initializes the speaker. If it fails the caller should fall back to nullAudioBackend.
+func newBeepAudioBackend(sampleRate beep.SampleRate) (*beepAudioBackend, error) {
+	// A 1/30s buffer is small enough for shots to feel instant without underruns.
+	if err := speaker.Init(sampleRate, sampleRate.N(time.Second/30)); err != nil {
+		return nil, err
+	}
+	return &beepAudioBackend{sampleRate: sampleRate}, nil
+}
+
+// Load decodes a .wav or .ogg file entirely into memory, resampled to the speaker's rate.
+func (b *beepAudioBackend) Load(path string) (AudioClip, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		streamer, format, err = wav.Decode(file)
+	case ".ogg":
+		streamer, format, err = vorbis.Decode(file)
+	default:
+		err = fmt.Errorf("unsupported sound format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	defer streamer.Close()
+
+	return b.resample(streamer, format.SampleRate), nil
+}
+
+// LoadSamples copies mono samples into both channels of a clip.
+func (b *beepAudioBackend) LoadSamples(samples []float64, sampleRate int) (AudioClip, error) {
+	position := 0
+	streamer := beep.StreamerFunc(func(out [][2]float64) (n int, ok bool) {
+		for n < len(out) && position < len(samples) {
+			out[n] = [2]float64{samples[position], samples[position]}
+			n++
+			position++
+		}
+		return n, n > 0
+	})
+	return b.resample(streamer, beep.SampleRate(sampleRate)), nil
+}
+
+// resample buffers the streamer at the speaker's sample rate.
+func (b *beepAudioBackend) resample(streamer beep.Streamer, sampleRate beep.SampleRate) *beep.Buffer {
+	buffer := beep.NewBuffer(beep.Format{SampleRate: b.sampleRate, NumChannels: 2, Precision: 2})
+	buffer.Append(beep.Resample(4, sampleRate, b.sampleRate, streamer))
+	return buffer
+}
+
+func (b *beepAudioBackend) Play(clip AudioClip, volume float64, loop bool) AudioVoice {
+	buffer := clip.(*beep.Buffer)
+	var streamer beep.Streamer
+	if loop {
+		streamer = beep.Loop(-1, buffer.Streamer(0, buffer.Len()))
+	} else {
+		streamer = buffer.Streamer(0, buffer.Len())
+	}
+
+	voice := &beepAudioVoice{volume: &effects.Volume{Streamer: streamer, Base: 2}}
+	voice.ctrl = &beep.Ctrl{Streamer: voice.volume}
+	setBeepVolume(voice.volume, volume)
+
+	speaker.Play(voice.ctrl)
+	return voice
+}
+
+type beepAudioVoice struct {
+	ctrl   *beep.Ctrl
+	volume *effects.Volume
+}
+
+// Stop the voice. The speaker drops it on its next pass.
+func (v *beepAudioVoice) Stop() {
+	speaker.Lock()
+	v.ctrl.Streamer = nil
+	speaker.Unlock()
+}
+
+func (v *beepAudioVoice) SetVolume(volume float64) {
+	speaker.Lock()
+	setBeepVolume(v.volume, volume)
+	speaker.Unlock()
+}
+
+// setBeepVolume converts a linear 0..1 volume to beep's logarithmic one.
+func setBeepVolume(v *effects.Volume, volume float64) {
+	v.Silent = volume <= 0
+	if !v.Silent {
+		v.Volume = math.Log2(volume)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+)
+
+// benchmarkDt is the fixed time step of a benchmark, one frame at 60fps.
+const benchmarkDt = 1.0 / 60
+
+// runBenchmark plays games headless, flown by the Autopilot, and prints how far each got. It is
+// meant for tuning difficulty: the same seed plays out the same way, so settings can be compared.
+// A game that lasts longer than maxSeconds is stopped where it is.
+func runBenchmark(games int, maxSeconds float64, stateLog *StateLog) error {
+	stage, err := makeGameStage(nil)
+	if err != nil {
+		return err
+	}
+	audio := MakeAudio(nullAudioBackend{})
+
+	totalScore, totalLevel, totalSeconds := 0, 0, 0.0
+	for i := 1; i <= games; i++ {
+		game := makeGame(&stage, &audio, nil)
+		game.demo = true
+		game.stateLog = stateLog
+
+		over := false
+		score, level := 0, 0
+		game.events.OnGameOver(func(e GameOver) {
+			over = true
+			score, level = e.Score, e.Level
+		})
+
+		seconds := 0.0
+		for !over && seconds < maxSeconds {
+			game.update(benchmarkDt)
+			seconds += benchmarkDt
+		}
+		if !over {
+			score, level = game.player.score, game.player.level
+		}
+
+		fmt.Printf("game %v: score %v, level %v, %.0f seconds\n", i, score, level, seconds)
+		totalScore += score
+		totalLevel += level
+		totalSeconds += seconds
+	}
+
+	n := float64(games)
+	fmt.Printf("average: score %.0f, level %.1f, %.0f seconds\n",
+		float64(totalScore)/n, float64(totalLevel)/n, totalSeconds/n)
+	return nil
+}
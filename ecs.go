@@ -0,0 +1,566 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/text"
+)
+
+// Entity identifies an entity in a World. Entity 0 is reserved (means "no entity").
+type Entity int
+
+// World holds entities and their components, each kind of component in its own dense array, so
+// systems can iterate over just the entities that have the components they need. Behaviour comes
+// from which components an entity has rather than from embedding, so e.g. text can wrap around the
+// screen or expire like a shot.
+//
+// Every Stage has a World, updated and drawn after its Actors. Each entity has an EntityActor
+// standing in for it among the Stage's Actors, so code written for Actors keeps working with
+// entities while Actors are migrated.
+type World struct {
+	nextEntity Entity
+	kinds      map[Entity]string
+	actors     map[Entity]*EntityActor
+
+	transforms transformStore
+	velocities velocityStore
+	sprites    spriteStore
+	texts      textStore
+	wraps      wrapStore
+	lifetimes  lifetimeStore
+	colliders  colliderStore
+}
+
+func makeWorld() *World {
+	w := &World{nextEntity: 1}
+	w.reset()
+	return w
+}
+
+// reset removes every entity. Entities aren't reused, so stale Entities don't refer to new ones.
+func (w *World) reset() {
+	*w = World{nextEntity: w.nextEntity, kinds: make(map[Entity]string), actors: make(map[Entity]*EntityActor)}
+}
+
+// Transform places an entity on the Stage. Every entity has one.
+type Transform struct {
+	position pixel.Vec
+	rotation float64
+	scale    float64
+}
+
+func (t *Transform) matrix() pixel.Matrix {
+	return pixel.IM.Scaled(pixel.ZV, t.scale).Rotated(pixel.ZV, t.rotation).Moved(t.position)
+}
+
+// Velocity moves an entity. Like BaseActor's velocity, linear is added once per update, while
+// angular is in radians per second.
+type Velocity struct {
+	linear  pixel.Vec
+	angular float64
+}
+
+// Sprite draws a frame of the Stage's spritesheet centered on an entity.
+type Sprite struct {
+	sprite *pixel.Sprite
+}
+
+func makeSprite(stage *Stage, frame int) Sprite {
+	return Sprite{sprite: pixel.NewSprite(stage.spritesheet, stage.frames[frame])}
+}
+
+// Text draws text from an entity's position, centered on it horizontally if centered.
+type Text struct {
+	text     string
+	centered bool
+	txt      *text.Text
+}
+
+func makeText(stage *Stage, s string) Text {
+	return Text{text: s, txt: text.New(pixel.ZV, stage.textAtlas)}
+}
+
+// render lays the text out. It is laid out afresh each time, so restoring a Text's string is enough.
+func (t *Text) render() {
+	t.txt.Clear()
+	fmt.Fprintln(t.txt, t.text)
+}
+
+// bounds returns the Text's bounds in its entity's local coordinates.
+func (t *Text) bounds() pixel.Rect {
+	t.render()
+	bounds := t.txt.Bounds()
+	if t.centered {
+		bounds = bounds.Moved(pixel.V(-bounds.W()/2, 0))
+	}
+	return bounds
+}
+
+// Wrap brings an entity back on the opposite side of the Stage from where it left.
+type Wrap struct{}
+
+// Lifetime removes an entity once its seconds are up.
+type Lifetime struct {
+	remaining float64
+}
+
+// Collider gives an entity a convex collision polygon in its local coordinates. Without one its
+// EntityActor collides using its Bounds.
+type Collider struct {
+	polygon Polygon
+}
+
+// AddEntity adds a new entity of the kind to the Stage's World, at the origin, along with the
+// EntityActor that stands in for it.
+func (s *Stage) AddEntity(kind string) Entity {
+	w := s.world
+	e := w.nextEntity
+	w.nextEntity++
+	w.kinds[e] = kind
+	w.transforms.add(e, Transform{scale: 1})
+	w.actors[e] = &EntityActor{stage: s, entity: e, tags: kindTags[kind]}
+	s.AddActor(w.actors[e])
+	return e
+}
+
+// RemoveEntity removes the entity, its components and its EntityActor.
+func (s *Stage) RemoveEntity(e Entity) {
+	s.RemoveActor(s.world.actors[e])
+}
+
+// HasEntity reports whether the entity is in the Stage's World.
+func (s *Stage) HasEntity(e Entity) bool {
+	_, ok := s.world.kinds[e]
+	return ok
+}
+
+// worldWith returns the Stage's World, checking the entity is in it.
+func (s *Stage) worldWith(e Entity) *World {
+	if !s.HasEntity(e) {
+		panic(fmt.Sprintf("Entity not found. %v", e))
+	}
+	return s.world
+}
+
+// AddTransform places the entity, replacing its Transform.
+func (s *Stage) AddTransform(e Entity, c Transform) {
+	s.worldWith(e).transforms.add(e, c)
+}
+
+// AddVelocity gives the entity a Velocity, or replaces the one it has. The same goes for the other
+// components.
+func (s *Stage) AddVelocity(e Entity, c Velocity) {
+	s.worldWith(e).velocities.add(e, c)
+}
+
+func (s *Stage) AddSprite(e Entity, c Sprite) {
+	s.worldWith(e).sprites.add(e, c)
+}
+
+func (s *Stage) AddText(e Entity, c Text) {
+	s.worldWith(e).texts.add(e, c)
+}
+
+func (s *Stage) AddWrap(e Entity) {
+	s.worldWith(e).wraps.add(e, Wrap{})
+}
+
+func (s *Stage) AddLifetime(e Entity, c Lifetime) {
+	s.worldWith(e).lifetimes.add(e, c)
+}
+
+func (s *Stage) AddCollider(e Entity, c Collider) {
+	s.worldWith(e).colliders.add(e, c)
+}
+
+// removeEntity removes the entity from the World. Use Stage.RemoveEntity to remove its EntityActor too.
+func (w *World) removeEntity(e Entity) {
+	delete(w.kinds, e)
+	delete(w.actors, e)
+	w.transforms.remove(e)
+	w.velocities.remove(e)
+	w.sprites.remove(e)
+	w.texts.remove(e)
+	w.wraps.remove(e)
+	w.lifetimes.remove(e)
+	w.colliders.remove(e)
+}
+
+// update runs the systems that simulate: movement, wrapping and lifetimes.
+func (w *World) update(stage *Stage, dt float64) {
+	for i, e := range w.velocities.entities {
+		velocity := &w.velocities.data[i]
+		transform := w.transforms.get(e)
+		transform.position = transform.position.Add(velocity.linear)
+		transform.rotation += velocity.angular * dt
+	}
+
+	for _, e := range w.wraps.entities {
+		wrapAroundVec(&w.transforms.get(e).position, &stage.bounds)
+	}
+
+	var expired []Entity
+	for i, e := range w.lifetimes.entities {
+		lifetime := &w.lifetimes.data[i]
+		lifetime.remaining -= dt
+		if lifetime.remaining <= 0 {
+			expired = append(expired, e)
+		}
+	}
+	for _, e := range expired {
+		stage.RemoveEntity(e)
+	}
+}
+
+// draw runs the systems that draw: sprites, then text on top.
+func (w *World) draw(stage *Stage) {
+	for i, e := range w.sprites.entities {
+		w.sprites.data[i].sprite.Draw(stage.win, w.actors[e].Transform())
+	}
+
+	for i, e := range w.texts.entities {
+		t := &w.texts.data[i]
+		t.render()
+		matrix := w.actors[e].Transform()
+		if t.centered {
+			matrix = pixel.IM.Moved(pixel.V(-t.txt.Bounds().W()/2, 0)).Chained(matrix)
+		}
+		t.txt.Draw(stage.win, matrix)
+	}
+}
+
+// clone returns a copy of the World that shares nothing that changes with it.
+func (w *World) clone() *World {
+	c := *w
+	c.kinds = make(map[Entity]string, len(w.kinds))
+	for e, kind := range w.kinds {
+		c.kinds[e] = kind
+	}
+	c.actors = make(map[Entity]*EntityActor, len(w.actors))
+	for e, actor := range w.actors {
+		c.actors[e] = actor
+	}
+	c.transforms = w.transforms.clone()
+	c.velocities = w.velocities.clone()
+	c.sprites = w.sprites.clone()
+	c.texts = w.texts.clone()
+	c.wraps = w.wraps.clone()
+	c.lifetimes = w.lifetimes.clone()
+	c.colliders = w.colliders.clone()
+	return &c
+}
+
+//
+
+// EntityActor stands in for an entity among a Stage's Actors. Its Update and Draw don't do anything,
+// as the World's systems update and draw the entity. Removing it from the Stage removes the entity.
+type EntityActor struct {
+	stage  *Stage
+	entity Entity
+	tags   []string
+	handle ActorHandle
+}
+
+func (a *EntityActor) Update(dt float64) {}
+
+func (a *EntityActor) Draw() {}
+
+func (a *EntityActor) actorHandle() *ActorHandle {
+	return &a.handle
+}
+
+func (a *EntityActor) Kind() string {
+	return a.stage.world.kinds[a.entity]
+}
+
+func (a *EntityActor) Tags() []string {
+	return a.tags
+}
+
+func (a *EntityActor) transform() *Transform {
+	if t := a.stage.world.transforms.get(a.entity); t != nil {
+		return t
+	}
+	return &Transform{scale: 1}
+}
+
+func (a *EntityActor) Position() pixel.Vec {
+	return a.transform().position
+}
+
+func (a *EntityActor) Scale() float64 {
+	return a.transform().scale
+}
+
+func (a *EntityActor) Rotation() float64 {
+	return a.transform().rotation
+}
+
+func (a *EntityActor) Velocity() pixel.Vec {
+	if v := a.stage.world.velocities.get(a.entity); v != nil {
+		return v.linear
+	}
+	return pixel.ZV
+}
+
+func (a *EntityActor) Transform() pixel.Matrix {
+	return a.stage.worldTransform(a.handle, a.transform().matrix())
+}
+
+// Bounds returns the bounds of the entity's Sprite or Text, in its local coordinates.
+func (a *EntityActor) Bounds() pixel.Rect {
+	w := a.stage.world
+	if s := w.sprites.get(a.entity); s != nil {
+		halfW := s.sprite.Frame().W() / 2
+		halfH := s.sprite.Frame().H() / 2
+		return pixel.R(-halfW, -halfH, halfW, halfH)
+	}
+	if t := w.texts.get(a.entity); t != nil {
+		return t.bounds()
+	}
+	return pixel.Rect{}
+}
+
+func (a *EntityActor) ScaledBounds() pixel.Rect {
+	t := a.transform()
+	bounds := a.Bounds()
+	return pixel.Rect{Min: bounds.Min.Scaled(t.scale).Add(t.position), Max: bounds.Max.Scaled(t.scale).Add(t.position)}
+}
+
+func (a *EntityActor) CollisionPolygon() Polygon {
+	if c := a.stage.world.colliders.get(a.entity); c != nil {
+		return c.polygon
+	}
+	return polygonFromRect(a.Bounds())
+}
+
+//
+
+// entitySet is the bookkeeping shared by the component stores: which entity each element of the
+// dense array belongs to, and where each entity's element is. It keeps a store's componentData in
+// step as entities come and go.
+type entitySet struct {
+	entities []Entity
+	index    map[Entity]int
+}
+
+// componentData is a store's dense array of components.
+type componentData interface {
+	grow()                 // Appends a zero component.
+	move(from int, to int) // Copies a component over another.
+	truncate(n int)        // Drops the components from n on.
+}
+
+// insert returns the index of the entity's element in data, adding one if need be.
+func (s *entitySet) insert(e Entity, data componentData) int {
+	if i, ok := s.index[e]; ok {
+		return i
+	}
+	if s.index == nil {
+		s.index = make(map[Entity]int)
+	}
+	s.index[e] = len(s.entities)
+	s.entities = append(s.entities, e)
+	data.grow()
+	return len(s.entities) - 1
+}
+
+// delete removes the entity's element, if it has one, moving the last element into its place to
+// keep the array dense.
+func (s *entitySet) delete(e Entity, data componentData) {
+	i, ok := s.index[e]
+	if !ok {
+		return
+	}
+	last := len(s.entities) - 1
+	moved := s.entities[last]
+	s.entities[i] = moved
+	s.index[moved] = i
+	s.entities = s.entities[:last]
+	delete(s.index, e)
+	data.move(last, i)
+	data.truncate(last)
+}
+
+func (s *entitySet) has(e Entity) bool {
+	_, ok := s.index[e]
+	return ok
+}
+
+func (s entitySet) clone() entitySet {
+	c := entitySet{entities: append([]Entity(nil), s.entities...), index: make(map[Entity]int, len(s.index))}
+	for e, i := range s.index {
+		c.index[e] = i
+	}
+	return c
+}
+
+type transformData []Transform
+
+func (d *transformData) grow()                 { *d = append(*d, Transform{}) }
+func (d *transformData) move(from int, to int) { (*d)[to] = (*d)[from] }
+func (d *transformData) truncate(n int)        { *d = (*d)[:n] }
+
+type transformStore struct {
+	entitySet
+	data transformData
+}
+
+func (s *transformStore) add(e Entity, c Transform) { s.data[s.insert(e, &s.data)] = c }
+func (s *transformStore) remove(e Entity)           { s.delete(e, &s.data) }
+
+func (s *transformStore) get(e Entity) *Transform {
+	if i, ok := s.index[e]; ok {
+		return &s.data[i]
+	}
+	return nil
+}
+
+func (s transformStore) clone() transformStore {
+	return transformStore{entitySet: s.entitySet.clone(), data: append(transformData(nil), s.data...)}
+}
+
+type velocityData []Velocity
+
+func (d *velocityData) grow()                 { *d = append(*d, Velocity{}) }
+func (d *velocityData) move(from int, to int) { (*d)[to] = (*d)[from] }
+func (d *velocityData) truncate(n int)        { *d = (*d)[:n] }
+
+type velocityStore struct {
+	entitySet
+	data velocityData
+}
+
+func (s *velocityStore) add(e Entity, c Velocity) { s.data[s.insert(e, &s.data)] = c }
+func (s *velocityStore) remove(e Entity)          { s.delete(e, &s.data) }
+
+func (s *velocityStore) get(e Entity) *Velocity {
+	if i, ok := s.index[e]; ok {
+		return &s.data[i]
+	}
+	return nil
+}
+
+func (s velocityStore) clone() velocityStore {
+	return velocityStore{entitySet: s.entitySet.clone(), data: append(velocityData(nil), s.data...)}
+}
+
+type spriteData []Sprite
+
+func (d *spriteData) grow()                 { *d = append(*d, Sprite{}) }
+func (d *spriteData) move(from int, to int) { (*d)[to] = (*d)[from] }
+func (d *spriteData) truncate(n int)        { *d = (*d)[:n] }
+
+type spriteStore struct {
+	entitySet
+	data spriteData
+}
+
+func (s *spriteStore) add(e Entity, c Sprite) { s.data[s.insert(e, &s.data)] = c }
+func (s *spriteStore) remove(e Entity)        { s.delete(e, &s.data) }
+
+func (s *spriteStore) get(e Entity) *Sprite {
+	if i, ok := s.index[e]; ok {
+		return &s.data[i]
+	}
+	return nil
+}
+
+func (s spriteStore) clone() spriteStore {
+	return spriteStore{entitySet: s.entitySet.clone(), data: append(spriteData(nil), s.data...)}
+}
+
+type textData []Text
+
+func (d *textData) grow()                 { *d = append(*d, Text{}) }
+func (d *textData) move(from int, to int) { (*d)[to] = (*d)[from] }
+func (d *textData) truncate(n int)        { *d = (*d)[:n] }
+
+type textStore struct {
+	entitySet
+	data textData
+}
+
+func (s *textStore) add(e Entity, c Text) { s.data[s.insert(e, &s.data)] = c }
+func (s *textStore) remove(e Entity)      { s.delete(e, &s.data) }
+
+func (s *textStore) get(e Entity) *Text {
+	if i, ok := s.index[e]; ok {
+		return &s.data[i]
+	}
+	return nil
+}
+
+func (s textStore) clone() textStore {
+	return textStore{entitySet: s.entitySet.clone(), data: append(textData(nil), s.data...)}
+}
+
+// wrapData keeps nothing, as Wrap has no fields. The entities are all there is to a wrapStore.
+type wrapData struct{}
+
+func (d *wrapData) grow()                 {}
+func (d *wrapData) move(from int, to int) {}
+func (d *wrapData) truncate(n int)        {}
+
+type wrapStore struct {
+	entitySet
+	data wrapData
+}
+
+func (s *wrapStore) add(e Entity, c Wrap) { s.insert(e, &s.data) }
+func (s *wrapStore) remove(e Entity)      { s.delete(e, &s.data) }
+
+func (s wrapStore) clone() wrapStore {
+	return wrapStore{entitySet: s.entitySet.clone()}
+}
+
+type lifetimeData []Lifetime
+
+func (d *lifetimeData) grow()                 { *d = append(*d, Lifetime{}) }
+func (d *lifetimeData) move(from int, to int) { (*d)[to] = (*d)[from] }
+func (d *lifetimeData) truncate(n int)        { *d = (*d)[:n] }
+
+type lifetimeStore struct {
+	entitySet
+	data lifetimeData
+}
+
+func (s *lifetimeStore) add(e Entity, c Lifetime) { s.data[s.insert(e, &s.data)] = c }
+func (s *lifetimeStore) remove(e Entity)          { s.delete(e, &s.data) }
+
+func (s *lifetimeStore) get(e Entity) *Lifetime {
+	if i, ok := s.index[e]; ok {
+		return &s.data[i]
+	}
+	return nil
+}
+
+func (s lifetimeStore) clone() lifetimeStore {
+	return lifetimeStore{entitySet: s.entitySet.clone(), data: append(lifetimeData(nil), s.data...)}
+}
+
+type colliderData []Collider
+
+func (d *colliderData) grow()                 { *d = append(*d, Collider{}) }
+func (d *colliderData) move(from int, to int) { (*d)[to] = (*d)[from] }
+func (d *colliderData) truncate(n int)        { *d = (*d)[:n] }
+
+type colliderStore struct {
+	entitySet
+	data colliderData
+}
+
+func (s *colliderStore) add(e Entity, c Collider) { s.data[s.insert(e, &s.data)] = c }
+func (s *colliderStore) remove(e Entity)          { s.delete(e, &s.data) }
+
+func (s *colliderStore) get(e Entity) *Collider {
+	if i, ok := s.index[e]; ok {
+		return &s.data[i]
+	}
+	return nil
+}
+
+func (s colliderStore) clone() colliderStore {
+	return colliderStore{entitySet: s.entitySet.clone(), data: append(colliderData(nil), s.data...)}
+}
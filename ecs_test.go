@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// checkEntitySet fails the test unless the set's index matches its entities, and its data has an
+// element for each.
+func checkEntitySet(t *testing.T, name string, s entitySet, data int) {
+	t.Helper()
+	if len(s.entities) != data || len(s.index) != data {
+		t.Errorf("%v: %v entities, %v indexed and %v components", name, len(s.entities), len(s.index), data)
+	}
+	for i, e := range s.entities {
+		if s.index[e] != i {
+			t.Errorf("%v: entity %v is at %v, indexed at %v", name, e, i, s.index[e])
+		}
+	}
+}
+
+func TestEntityStores(t *testing.T) {
+	stage := makeTestStage()
+	w := stage.world
+	var entities []Entity
+	for i := 0; i < 4; i++ {
+		e := stage.AddEntity("debris")
+		stage.AddTransform(e, Transform{position: pixel.V(float64(i), 0), scale: 1})
+		stage.AddVelocity(e, Velocity{linear: pixel.V(0, float64(i))})
+		if i%2 == 1 {
+			stage.AddLifetime(e, Lifetime{remaining: float64(i)})
+		}
+		entities = append(entities, e)
+	}
+
+	// Removing an entity moves the last of each store into its place.
+	stage.RemoveEntity(entities[0])
+	if want := []Entity{entities[3], entities[1], entities[2]}; !sameEntities(w.velocities.entities, want) {
+		t.Errorf("velocities of %v, want %v", w.velocities.entities, want)
+	}
+	stage.RemoveEntity(entities[1])
+	if want := []Entity{entities[3]}; !sameEntities(w.lifetimes.entities, want) {
+		t.Errorf("lifetimes of %v, want %v", w.lifetimes.entities, want)
+	}
+
+	// Adding a component an entity has replaces it where it is. Adding one it doesn't appends it.
+	stage.AddVelocity(entities[3], Velocity{linear: pixel.V(0, 30)})
+	w.velocities.remove(entities[2])
+	stage.AddVelocity(entities[2], Velocity{linear: pixel.V(0, 20)})
+	if want := []Entity{entities[3], entities[2]}; !sameEntities(w.velocities.entities, want) {
+		t.Errorf("velocities of %v, want %v", w.velocities.entities, want)
+	}
+
+	for _, e := range entities[2:] {
+		i := float64(e - entities[0])
+		if p := w.transforms.get(e).position; p != pixel.V(i, 0) {
+			t.Errorf("entity %v is at %v", e, p)
+		}
+		if v := w.velocities.get(e).linear; v != pixel.V(0, i*10) {
+			t.Errorf("entity %v has velocity %v", e, v)
+		}
+	}
+	if l := w.lifetimes.get(entities[3]); l == nil || l.remaining != 3 {
+		t.Errorf("entity %v has lifetime %v", entities[3], l)
+	}
+	if w.velocities.get(entities[0]) != nil || w.transforms.get(entities[1]) != nil || w.lifetimes.get(entities[2]) != nil {
+		t.Error("components of removed entities, or never added, were found")
+	}
+	checkEntitySet(t, "transforms", w.transforms.entitySet, len(w.transforms.data))
+	checkEntitySet(t, "velocities", w.velocities.entitySet, len(w.velocities.data))
+	checkEntitySet(t, "lifetimes", w.lifetimes.entitySet, len(w.lifetimes.data))
+	if len(w.transforms.entities) != 2 {
+		t.Errorf("%v transforms left", len(w.transforms.entities))
+	}
+}
+
+func sameEntities(a []Entity, b []Entity) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWorldClone(t *testing.T) {
+	stage := makeTestStage()
+	kept := stage.AddEntity("debris")
+	stage.AddVelocity(kept, Velocity{linear: pixel.V(1, 0)})
+	stage.AddLifetime(kept, Lifetime{remaining: 1})
+	removed := stage.AddEntity("debris")
+	stage.AddWrap(removed)
+
+	clone := stage.world.clone()
+	stage.AddTransform(kept, Transform{position: pixel.V(10, 10), scale: 2})
+	stage.world.velocities.get(kept).linear = pixel.V(5, 5)
+	stage.world.lifetimes.get(kept).remaining = 0.5
+	stage.AddCollider(kept, Collider{polygon: Polygon{pixel.V(0, 0), pixel.V(1, 0), pixel.V(0, 1)}})
+	stage.RemoveEntity(removed)
+	stage.AddEntity("debris")
+
+	if clone.transforms.get(kept).position != pixel.ZV || clone.velocities.get(kept).linear != pixel.V(1, 0) ||
+		clone.lifetimes.get(kept).remaining != 1 || clone.colliders.get(kept) != nil {
+		t.Error("changing the World's components changed its clone's")
+	}
+	if _, ok := clone.kinds[removed]; !ok || !clone.wraps.has(removed) || clone.transforms.get(removed) == nil ||
+		clone.actors[removed] == nil {
+		t.Error("removing an entity from the World removed it from its clone")
+	}
+	if len(clone.kinds) != 2 || clone.nextEntity != removed+1 {
+		t.Errorf("the clone has %v entities and would add %v next", len(clone.kinds), clone.nextEntity)
+	}
+
+	// Nor does changing the clone change the World.
+	clone.transforms.get(kept).scale = 3
+	clone.removeEntity(kept)
+	if !stage.HasEntity(kept) || stage.world.transforms.get(kept).scale != 2 {
+		t.Error("changing the clone changed the World")
+	}
+}
+
+func TestLifetimeExpiry(t *testing.T) {
+	stage := makeTestStage()
+	e := stage.AddEntity("debris")
+	stage.AddLifetime(e, Lifetime{remaining: 0.04})
+	actor := stage.world.actors[e]
+	other := stage.AddEntity("debris")
+
+	for i := 0; i < 2; i++ {
+		stage.Update(1.0 / 60)
+	}
+	if !stage.HasEntity(e) || !stage.HasActor(actor) {
+		t.Fatal("the entity expired early")
+	}
+	stage.Update(1.0 / 60)
+	if stage.HasEntity(e) || stage.HasActor(actor) {
+		t.Error("the entity outlived its Lifetime")
+	}
+	if debris := stage.FindActorsByKind("debris"); len(debris) != 1 || debris[0] != stage.world.actors[other] {
+		t.Errorf("%v debris left, want the one without a Lifetime", len(debris))
+	}
+	if stage.removed != 0 || len(stage.actors) != 1 {
+		t.Errorf("%v Actors, %v of them removed, after the Update", len(stage.actors), stage.removed)
+	}
+}
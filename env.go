@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+)
+
+// EnvConfig tunes an Env.
+type EnvConfig struct {
+	observation  string  // "features" or "frame".
+	nearestRocks int     // Rocks described in a feature vector.
+	frameWidth   int     // Width of a frame observation, in cells.
+	frameHeight  int     // Height of a frame observation, in cells.
+	frameSkip    int     // Frames simulated per Step, repeating the action.
+	maxSteps     int     // Steps before an episode is cut short. 0 for no limit.
+	lifePenalty  float64 // Reward lost when a ship is destroyed.
+	dt           float64 // Seconds per simulated frame.
+}
+
+var defaultEnvConfig = EnvConfig{observation: "features", nearestRocks: 8, frameWidth: 84, frameHeight: 63,
+	frameSkip: 4, maxSteps: 0, lifePenalty: 1000, dt: 1.0 / 60}
+
+// check returns an error if the config can't be used.
+func (c EnvConfig) check() error {
+	if c.observation != "features" && c.observation != "frame" {
+		return fmt.Errorf("unknown observation type %q", c.observation)
+	}
+	return nil
+}
+
+// Observation is what an agent sees after Reset or Step. Only the field for the Env's observation type is set.
+type Observation struct {
+	Features []float64 `json:"features,omitempty"`
+	Frame    []uint8   `json:"frame,omitempty"` // Row-major grayscale, top row first.
+	Width    int       `json:"width,omitempty"`
+	Height   int       `json:"height,omitempty"`
+}
+
+// Env wraps a headless Game for reinforcement learning, Gym style: Reset starts an episode, then
+// Step applies an action and reports the result until done. The agent flies the ship through the
+// same Actions as the keyboard.
+type Env struct {
+	config     EnvConfig
+	stage      Stage
+	audio      Audio
+	game       *Game
+	controller actionsController
+
+	steps     int
+	over      bool
+	points    int // Scored this episode.
+	shipsLost int
+}
+
+// actionsController flies the ship with whatever Actions it's set to, e.g. the action of the Env's
+// current Step.
+type actionsController struct {
+	actions Actions
+}
+
+func (c *actionsController) Actions(ship *Ship) Actions {
+	return c.actions
+}
+
+func makeEnv(config EnvConfig) (*Env, error) {
+	if err := config.check(); err != nil {
+		return nil, err
+	}
+	stage, err := makeGameStage(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Env{config: config, stage: stage, audio: MakeAudio(nullAudioBackend{})}, nil
+}
+
+// Reset starts a new game from the given seed and returns the first observation. It fast-forwards
+// through the opening intermission, so the ship is in play when the agent first acts.
+func (e *Env) Reset(seed int64) Observation {
+	rand.Seed(seed)
+
+	e.controller.actions = 0
+	e.game = makeGame(&e.stage, &e.audio, &e.controller)
+	e.steps = 0
+	e.over = false
+	e.points = 0
+	e.shipsLost = 0
+	e.game.events.OnGameOver(func(GameOver) {
+		e.over = true
+	})
+	e.game.events.OnRockDestroyed(func(event RockDestroyed) {
+		e.points += event.Points
+	})
+	e.game.events.OnShipDestroyed(func(ShipDestroyed) {
+		e.shipsLost++
+	})
+
+	for e.game.intermission > 0 || e.ship() == nil {
+		e.game.update(e.config.dt)
+	}
+	return e.observe()
+}
+
+// Step flies the ship with the given Actions for frameSkip frames. The reward is the points scored,
+// less lifePenalty for each ship lost. Once done is returned the episode is over and Reset must be
+// called before stepping again.
+func (e *Env) Step(actions Actions) (observation Observation, reward float64, done bool) {
+	if e.game == nil || e.over {
+		panic("Step called on a finished episode. Call Reset first.")
+	}
+
+	e.controller.actions = actions
+	points, shipsLost := e.points, e.shipsLost
+	for i := 0; i < e.config.frameSkip && !e.over; i++ {
+		e.game.update(e.config.dt)
+	}
+	e.steps++
+
+	reward = float64(e.points-points) - float64(e.shipsLost-shipsLost)*e.config.lifePenalty
+
+	if e.config.maxSteps > 0 && e.steps >= e.config.maxSteps {
+		e.over = true
+	}
+	return e.observe(), reward, e.over
+}
+
+// ship returns the agent's ship, or nil if it is between lives.
+func (e *Env) ship() *Ship {
+	if ships := e.stage.FindActorsByKind("ship"); ships != nil {
+		return ships[0].(*Ship)
+	}
+	return nil
+}
+
+func (e *Env) observe() Observation {
+	if e.config.observation == "frame" {
+		return Observation{Frame: e.frame(), Width: e.config.frameWidth, Height: e.config.frameHeight}
+	}
+	return Observation{Features: e.features()}
+}
+
+// featuresPerRock is the length of each Rock's entry in the feature vector.
+const featuresPerRock = 6
+
+// featureCount returns the length of the feature vector.
+func (e *Env) featureCount() int {
+	return 10 + e.config.nearestRocks*featuresPerRock
+}
+
+// features describes the ship, then the nearest Rocks in order of distance. Positions are scaled so
+// the Stage spans -1..1, velocities so that 1 is the ship's top speed. Rocks are relative to the ship,
+// taking the wrapping edges into account, and missing ones are all zeros.
+//
+//	ship: present, x, y, vx, vy, cos(heading), sin(heading), in hyperspace, shielded, shield energy
+//	rock: present, dx, dy, dvx, dvy, radius
+func (e *Env) features() []float64 {
+	features := make([]float64, 0, e.featureCount())
+	bounds := e.stage.bounds
+	halfW, halfH := bounds.W()/2, bounds.H()/2
+	maxSpeed := e.game.flightModel.maxSpeed
+	if maxSpeed == 0 {
+		maxSpeed = 1
+	}
+	flag := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	ship := e.ship()
+	shipPosition, shipVelocity := pixel.ZV, pixel.ZV
+	if ship != nil {
+		shipPosition, shipVelocity = ship.position, ship.velocity
+		heading := ship.rotation + math.Pi/2
+		features = append(features, 1, ship.position.X/halfW, ship.position.Y/halfH,
+			ship.velocity.X/maxSpeed, ship.velocity.Y/maxSpeed, math.Cos(heading), math.Sin(heading),
+			flag(ship.hyperspaceTimer > 0), flag(ship.shielded), ship.player.shieldEnergy)
+	} else {
+		features = append(features, make([]float64, 10)...)
+	}
+
+	rocks := e.stage.FindActorsByKind("rock")
+	offsets := make([]pixel.Vec, len(rocks))
+	for i, rock := range rocks {
+		offsets[i] = wrapDelta(rock.Position().Sub(shipPosition), bounds)
+	}
+	for n := 0; n < e.config.nearestRocks; n++ {
+		nearest := -1
+		for i := range rocks {
+			if rocks[i] != nil && (nearest < 0 || offsets[i].Len() < offsets[nearest].Len()) {
+				nearest = i
+			}
+		}
+		if nearest < 0 {
+			features = append(features, make([]float64, featuresPerRock)...)
+			continue
+		}
+
+		rock := rocks[nearest]
+		velocity := rock.Velocity().Sub(shipVelocity)
+		features = append(features, 1, offsets[nearest].X/halfW, offsets[nearest].Y/halfH,
+			velocity.X/maxSpeed, velocity.Y/maxSpeed, actorRadius(rock)/halfH)
+		rocks[nearest] = nil
+	}
+	return features
+}
+
+// frameIntensities is the gray level each kind of Actor is drawn with in a frame observation.
+// Kinds not listed, like the HUD, aren't drawn.
+var frameIntensities = []struct {
+	kind      string
+	intensity uint8
+}{
+	{"powerUp", 64},
+	{"shot", 128},
+	{"missile", 128},
+	{"ship", 192},
+	{"rock", 255},
+}
+
+// frame renders a low resolution grayscale image of the Stage. There is no window when headless,
+// so the collision polygons are rasterized instead of the sprites. A cell is lit by any Actor
+// covering part of it.
+func (e *Env) frame() []uint8 {
+	width, height := e.config.frameWidth, e.config.frameHeight
+	frame := make([]uint8, width*height)
+	bounds := e.stage.bounds
+	cellW, cellH := bounds.W()/float64(width), bounds.H()/float64(height)
+	cellRadius := math.Max(cellW, cellH) / 2
+
+	for _, entry := range frameIntensities {
+		for _, actor := range e.stage.FindActorsByKind(entry.kind) {
+			if ship, ok := actor.(*Ship); ok && ship.hyperspaceTimer > 0 {
+				continue
+			}
+			polygon := collisionPolygon(actor)
+			extent := pixel.R(polygon[0].X, polygon[0].Y, polygon[0].X, polygon[0].Y)
+			for _, v := range polygon {
+				extent = extent.Union(pixel.R(v.X, v.Y, v.X, v.Y))
+			}
+			minCol := int(math.Max(0, math.Floor((extent.Min.X-bounds.Min.X)/cellW)))
+			maxCol := int(math.Min(float64(width-1), math.Floor((extent.Max.X-bounds.Min.X)/cellW)))
+			minRow := int(math.Max(0, math.Floor((bounds.Max.Y-extent.Max.Y)/cellH)))
+			maxRow := int(math.Min(float64(height-1), math.Floor((bounds.Max.Y-extent.Min.Y)/cellH)))
+			for row := minRow; row <= maxRow; row++ {
+				for col := minCol; col <= maxCol; col++ {
+					center := pixel.V(bounds.Min.X+(float64(col)+0.5)*cellW, bounds.Max.Y-(float64(row)+0.5)*cellH)
+					if circleIntersectsPolygon(center, cellRadius, polygon) {
+						frame[row*width+col] = entry.intensity
+					}
+				}
+			}
+		}
+	}
+	return frame
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+)
+
+// envRequest is a command from a trainer. Requests and responses are JSON objects, one per line.
+//
+//	{"cmd": "spec"}                 -> {"actions": [...], "observation": "features", "shape": [58]}
+//	{"cmd": "reset", "seed": 1}     -> {"observation": {...}}
+//	{"cmd": "step", "action": 5}    -> {"observation": {...}, "reward": 20, "done": false}
+//
+// An action is a bit set: bit i is set to perform the i-th entry of the spec's actions.
+// Frame observations are base64 encoded bytes, as encoding/json does for []uint8.
+type envRequest struct {
+	Cmd    string `json:"cmd"`
+	Seed   int64  `json:"seed"`
+	Action uint8  `json:"action"`
+}
+
+type envResponse struct {
+	Observation *Observation `json:"observation,omitempty"`
+	Reward      float64      `json:"reward"`
+	Done        bool         `json:"done"`
+	Error       string       `json:"error,omitempty"`
+}
+
+type envSpec struct {
+	Actions     []string `json:"actions"`
+	Observation string   `json:"observation"`
+	Shape       []int    `json:"shape"` // Length of the feature vector, or frame height and width.
+}
+
+// envActionNames names the Actions bits, lowest first.
+var envActionNames = []string{"turnLeft", "turnRight", "thrust", "fire", "special"}
+
+// serveEnv listens for trainers on addr. Connections are served one at a time, sharing an Env,
+// because the simulation draws on the global random source.
+func serveEnv(addr string, config EnvConfig) error {
+	env, err := makeEnv(config)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	log.Printf("Environment server listening on %v", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		env.game = nil
+		if err := serveEnvConn(conn, env); err != nil {
+			log.Printf("Trainer %v: %v", conn.RemoteAddr(), err)
+		}
+		conn.Close()
+	}
+}
+
+// serveEnvConn answers a trainer's requests until it disconnects.
+func serveEnvConn(conn net.Conn, env *Env) error {
+	config := env.config
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+	for {
+		var request envRequest
+		if err := decoder.Decode(&request); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var response interface{}
+		switch request.Cmd {
+		case "spec":
+			shape := []int{env.featureCount()}
+			if config.observation == "frame" {
+				shape = []int{config.frameHeight, config.frameWidth}
+			}
+			response = envSpec{Actions: envActionNames, Observation: config.observation, Shape: shape}
+		case "reset":
+			observation := env.Reset(request.Seed)
+			response = envResponse{Observation: &observation}
+		case "step":
+			if env.game == nil || env.over {
+				response = envResponse{Error: "no episode in progress, reset first"}
+				break
+			}
+			observation, reward, done := env.Step(Actions(request.Action))
+			response = envResponse{Observation: &observation, Reward: reward, Done: done}
+		default:
+			response = envResponse{Error: fmt.Sprintf("unknown command %q", request.Cmd)}
+		}
+
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+// RockDestroyed is published when a Rock is broken up, whether by a Shot or by ramming the Ship.
+type RockDestroyed struct {
+	Rock   *Rock
+	By     Actor // The Shot or Ship that hit it.
+	Points int
+}
+
+// ShipDestroyed is published when the Ship collides with a Rock.
+type ShipDestroyed struct {
+	Ship *Ship
+	By   Actor
+}
+
+// ShotFired is published for each projectile the Ship's Weapon fires.
+type ShotFired struct {
+	Ship       *Ship
+	Weapon     string
+	Projectile Actor
+}
+
+// ShipThrust is published when the Ship starts or stops thrusting.
+type ShipThrust struct {
+	Ship      *Ship
+	Thrusting bool
+}
+
+// PowerUpCollected is published when the Ship picks up a PowerUp.
+type PowerUpCollected struct {
+	Ship *Ship
+	Name string
+}
+
+// LevelCleared is published when the last Rock of a level is destroyed, before the next level starts.
+type LevelCleared struct {
+	Level int
+}
+
+// ExtraLife is published when the player is awarded another ship.
+type ExtraLife struct {
+	Lives int
+}
+
+// GameOver is published when a player loses their last ship. In a two-player game the other
+// player may play on.
+type GameOver struct {
+	Player int // 1-based.
+	Score  int
+	Level  int
+}
+
+// EventBus lets audio, effects, stats, etc. react to game events without the Actors that cause
+// them knowing about it. Handlers are called synchronously, in subscription order.
+type EventBus struct {
+	rockDestroyed    []func(RockDestroyed)
+	shipDestroyed    []func(ShipDestroyed)
+	shotFired        []func(ShotFired)
+	shipThrust       []func(ShipThrust)
+	powerUpCollected []func(PowerUpCollected)
+	levelCleared     []func(LevelCleared)
+	extraLife        []func(ExtraLife)
+	gameOver         []func(GameOver)
+}
+
+func (b *EventBus) OnRockDestroyed(handler func(RockDestroyed)) {
+	b.rockDestroyed = append(b.rockDestroyed, handler)
+}
+
+func (b *EventBus) PublishRockDestroyed(event RockDestroyed) {
+	for _, handler := range b.rockDestroyed {
+		handler(event)
+	}
+}
+
+func (b *EventBus) OnShipDestroyed(handler func(ShipDestroyed)) {
+	b.shipDestroyed = append(b.shipDestroyed, handler)
+}
+
+func (b *EventBus) PublishShipDestroyed(event ShipDestroyed) {
+	for _, handler := range b.shipDestroyed {
+		handler(event)
+	}
+}
+
+func (b *EventBus) OnShotFired(handler func(ShotFired)) {
+	b.shotFired = append(b.shotFired, handler)
+}
+
+func (b *EventBus) PublishShotFired(event ShotFired) {
+	for _, handler := range b.shotFired {
+		handler(event)
+	}
+}
+
+func (b *EventBus) OnShipThrust(handler func(ShipThrust)) {
+	b.shipThrust = append(b.shipThrust, handler)
+}
+
+func (b *EventBus) PublishShipThrust(event ShipThrust) {
+	for _, handler := range b.shipThrust {
+		handler(event)
+	}
+}
+
+func (b *EventBus) OnPowerUpCollected(handler func(PowerUpCollected)) {
+	b.powerUpCollected = append(b.powerUpCollected, handler)
+}
+
+func (b *EventBus) PublishPowerUpCollected(event PowerUpCollected) {
+	for _, handler := range b.powerUpCollected {
+		handler(event)
+	}
+}
+
+func (b *EventBus) OnLevelCleared(handler func(LevelCleared)) {
+	b.levelCleared = append(b.levelCleared, handler)
+}
+
+func (b *EventBus) PublishLevelCleared(event LevelCleared) {
+	for _, handler := range b.levelCleared {
+		handler(event)
+	}
+}
+
+func (b *EventBus) OnExtraLife(handler func(ExtraLife)) {
+	b.extraLife = append(b.extraLife, handler)
+}
+
+func (b *EventBus) PublishExtraLife(event ExtraLife) {
+	for _, handler := range b.extraLife {
+		handler(event)
+	}
+}
+
+func (b *EventBus) OnGameOver(handler func(GameOver)) {
+	b.gameOver = append(b.gameOver, handler)
+}
+
+func (b *EventBus) PublishGameOver(event GameOver) {
+	for _, handler := range b.gameOver {
+		handler(event)
+	}
+}
@@ -2,38 +2,95 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"math"
 	"math/rand"
-	"time"
+	"sort"
 
 	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
 	"github.com/faiface/pixel/pixelgl"
 )
 
 // Game is the root of all game state and implements the game logic.
 type Game struct {
-	stage *Stage
-	level int
-	lives int
-	score int
+	stage     *Stage
+	audio     *Audio
+	events    EventBus
+	heartbeat Heartbeat
+	players   []*Player
+	player    *Player // Whose turn it is.
 
 	largeRockPoints  int
 	mediumRockPoints int
 	smallRockPoints  int
+	numberOfPlayers  int
 	numberOfLives    int
+	maxLives         int
 	newShipPoints    int
-
-	heldKeys      map[pixelgl.Button]bool
-	previousScore int
+	rockFragments    int     // How many pieces a Rock splits into.
+	fragmentSpread   float64 // Radians the pieces' headings fan out across.
+	impactTransfer   float64 // Fraction of the hitting Actor's velocity the pieces inherit.
+	powerUpChance    float64 // Chance (0..1) of a destroyed Rock dropping a PowerUp.
+	powerUpLifetime  float64 // Seconds an uncollected PowerUp lasts.
+
+	flightModel        FlightModel
+	weapon             string // The Weapon ships start with.
+	special            ShipSpecial
+	hyperspaceDuration float64
+	hyperspaceFailure  float64 // Chance (0..1) of not surviving a hyperspace jump.
+	shieldDrain        float64 // Energy used per second of shielding. A full charge is 1.
+	shieldRecharge     float64 // Energy regained per second with the shield down.
+
+	intermissionLength float64
+	turnLength         float64 // Seconds the banner announcing a player's turn is shown.
+	safeSpawnRadius    float64 // A new ship waits until no rock is this close to the center.
+
+	controller   Controller   // Flies the player's ships.
+	controllers  []Controller // Fly each player's ships in co-op, when there are several at once.
+	demo         bool         // The autopilot flies the ships instead.
+	coop         bool         // The players play at the same time instead of taking turns.
+	coopPlayers  int          // How many players a co-op game started from the title is for.
+	friendlyFire bool         // In co-op, shots destroy other players' ships.
+	sharedLives  bool         // In co-op, all players' ships come from player 1's lives.
+
+	state        GameState
+	attract      bool    // Cycle through the title, high scores and demo between games. Needs a window.
+	attractTimer float64 // Seconds left on the current title, high-score or demo screen.
+	highScores   []HighScore
+
+	quicksavePath string    // Where F5 saves the game and F9 loads it from. JSON if it ends in ".json".
+	stateLog      *StateLog // If not nil, records the state every frame, to find where runs diverge.
+
+	heldKeys     map[pixelgl.Button]bool
+	levelParams  LevelParams
+	levelRocks   int     // How many rocks must be destroyed to clear the level.
+	intermission float64 // Seconds left before the level's rocks appear, 0 once they have.
+	waveBanner   *TextActor
+	turnTimer    float64 // Seconds left on the banner announcing a new turn.
+	turnBanner   *TextActor
 }
 
-func makeGame(stage *Stage) *Game {
-	// Get fresh random numbers every run.
-	rand.Seed(time.Now().Unix())
-
-	g := Game{stage: stage, heldKeys: make(map[pixelgl.Button]bool),
+func makeGame(stage *Stage, audio *Audio, controller Controller) *Game {
+	g := Game{stage: stage, audio: audio, controller: controller, heldKeys: make(map[pixelgl.Button]bool),
 		largeRockPoints: 20, mediumRockPoints: 50, smallRockPoints: 100, newShipPoints: 10000, numberOfLives: 4,
+		numberOfPlayers: 1, coopPlayers: 2, maxLives: 10, quicksavePath: "quicksave.sav",
+		intermissionLength: 2, turnLength: 2, safeSpawnRadius: 120,
+		rockFragments: 2, fragmentSpread: math.Pi / 3, impactTransfer: 0.1,
+		powerUpChance: 0.08, powerUpLifetime: 8,
+		flightModel:        defaultFlightModel,
+		weapon:             "single",
+		special:            HyperspaceSpecial,
+		hyperspaceDuration: 0.5, hyperspaceFailure: 0.1,
+		shieldDrain: 0.5, shieldRecharge: 0.05,
 	}
+	g.heartbeat = makeHeartbeat(audio)
+
+	g.events.OnRockDestroyed(func(e RockDestroyed) {
+		g.creditedPlayer(e.By).score += e.Points
+	})
+	audio.SubscribeTo(&g.events)
+
 	g.reset()
 
 	// We must return a pointer to Game now that it has been initialized with Actors that reference it.
@@ -43,37 +100,173 @@ func makeGame(stage *Stage) *Game {
 
 func (g *Game) reset() {
 	g.stage.Reset()
+	g.audio.StopAll()
 
-	g.lives = g.numberOfLives
-	g.score = 0
+	g.players = nil
+	for i := 1; i <= g.numberOfPlayers; i++ {
+		g.players = append(g.players, makePlayer(g, i))
+	}
+	// The first player's ship appears once the spawn area is clear, without a change of turn.
+	g.player = g.players[0]
+	g.player.respawning = true
+	g.turnTimer = 0
+	g.turnBanner = nil
 
-	makeScore(g)
-	makeLives(g)
+	g.makeHUD()
 	g.newLevel(1)
 }
 
-func (g *Game) newLevel(level int) {
-	g.level = level
-	for i := 0; i < level; i++ {
-		makeRock(g, 1, nil)
+// makeHUD shows each player's score, lives, shield energy and weapon.
+func (g *Game) makeHUD() {
+	for _, player := range g.players {
+		makeScore(g, player)
+		if !g.coop || !g.sharedLives || player.number == 1 {
+			makeLives(g, player)
+		}
+		makeShieldMeter(g, player)
+		makeWeaponStatus(g, player)
+	}
+	if g.state == DemoState {
+		makeDemoBanner(g)
+	}
+}
+
+// shipController returns the Controller the player's new ships are flown by.
+func (g *Game) shipController(player *Player) Controller {
+	switch {
+	case g.demo || g.state == DemoState:
+		return makeAutopilot()
+	case g.coop && player.number <= len(g.controllers):
+		return g.controllers[player.number-1]
+	case g.controller == nil:
+		return makeAutopilot()
+	}
+	return g.controller
+}
+
+// rockDescendants returns how many rocks (including itself) must be destroyed to clear a rock of the
+// generation: 1 + f + f² for a large rock that splits into f fragments.
+func (g *Game) rockDescendants(generation int) int {
+	count, pieces := 0, 1
+	for ; generation <= len(rockScales); generation++ {
+		count += pieces
+		pieces *= g.rockFragments
+	}
+	return count
+}
+
+// rocksCleared returns the fraction (0..1) of the current level's rocks that have been destroyed.
+func (g *Game) rocksCleared() float64 {
+	remaining := 0
+	for _, actor := range g.stage.FindActorsByKind("rock") {
+		remaining += g.rockDescendants(actor.(*Rock).generation)
 	}
+	return 1 - float64(remaining)/float64(g.levelRocks)
 }
 
 func (g *Game) update(dt float64) {
 	stage := g.stage
 
+	// Debug keys need a window. The game can also run headless, e.g. for benchmarking the autopilot.
+	if stage.win != nil {
+		g.handleKeys()
+	}
+
+	g.step(dt)
+	if g.stateLog != nil {
+		if err := g.stateLog.record(g); err != nil {
+			log.Printf("Stopped logging the state: %v", err)
+			g.stateLog = nil
+		}
+	}
+
+	// Ask every actor to draw.
+	stage.Draw()
+}
+
+// step advances the Game by dt seconds without drawing it or responding to the debug keys.
+func (g *Game) step(dt float64) {
+	// Between games cycle through the title, high scores and demo.
+	if g.state != PlayingState {
+		g.updateAttract(dt)
+	}
+
+	// The demo is played like any other game, just not by the player.
+	if g.state == PlayingState || g.state == DemoState {
+		g.updatePlay(dt)
+	}
+
+	// Give every actor a chance to update.
+	g.stage.Update(dt)
+}
+
+// updatePlay applies the rules of the game: respawning, levels, extra lives and game over.
+func (g *Game) updatePlay(dt float64) {
+	stage := g.stage
+
+	// Replace destroyed ships while there are lives left to do it with.
+	if !g.updateShips(dt) {
+		return
+	}
+
+	// Between levels wait for the intermission to end. Otherwise, if all rocks have been
+	// destroyed go to the next level.
+	if g.intermission > 0 {
+		g.intermission -= dt
+		if g.intermission <= 0 {
+			g.startLevel()
+		}
+	} else if stage.FindActorsByKind("rock") == nil {
+		g.events.PublishLevelCleared(LevelCleared{Level: g.player.level})
+		g.newLevel(g.player.level + 1)
+	}
+
+	// If the player has crossed any scoring thresholds give them more ships.
+	g.awardExtraLives()
+
+	// The heartbeat quickens as the level's rocks are cleared.
+	if g.intermission <= 0 {
+		g.heartbeat.Update(dt, g.rocksCleared())
+	}
+}
+
+// playerOut puts the score of a player who has lost their last ship on the high-score table.
+// Scores from the demo don't count.
+func (g *Game) playerOut(player *Player) {
+	if g.state == DemoState {
+		return
+	}
+	g.events.PublishGameOver(GameOver{Player: player.number, Score: player.score, Level: player.level})
+	g.recordHighScore(player.score, player.level)
+}
+
+// gameOver ends the game once every player is out. In attract mode the high-score table is shown
+// before returning to the title. Otherwise a new game starts straight away.
+func (g *Game) gameOver() {
+	switch {
+	case g.state == DemoState:
+		g.showTitle()
+	case g.attract:
+		g.showHighScores()
+	default:
+		g.reset()
+	}
+}
+
+// handleKeys responds to the debug keys.
+func (g *Game) handleKeys() {
 	// Press r to reset the game.
-	if stage.win.Pressed(pixelgl.KeyR) {
+	if g.stage.win.Pressed(pixelgl.KeyR) {
 		if !g.heldKeys[pixelgl.KeyR] {
 			g.heldKeys[pixelgl.KeyR] = true
-			g.reset()
+			g.startGame(PlayingState, g.numberOfPlayers, g.coop)
 		}
 	} else {
 		g.heldKeys[pixelgl.KeyR] = false
 	}
 
 	// Press b to toggle Actor bounds drawing.
-	if stage.win.Pressed(pixelgl.KeyB) {
+	if g.stage.win.Pressed(pixelgl.KeyB) {
 		if !g.heldKeys[pixelgl.KeyB] {
 			g.heldKeys[pixelgl.KeyB] = true
 
@@ -83,46 +276,110 @@ func (g *Game) update(dt float64) {
 		g.heldKeys[pixelgl.KeyB] = false
 	}
 
-	// Press p to add 1,000 points to the score.
-	if stage.win.Pressed(pixelgl.KeyP) {
-		if !g.heldKeys[pixelgl.KeyP] {
-			g.heldKeys[pixelgl.KeyP] = true
+	// Press m to toggle muting.
+	if g.stage.win.Pressed(pixelgl.KeyM) {
+		if !g.heldKeys[pixelgl.KeyM] {
+			g.heldKeys[pixelgl.KeyM] = true
 
-			g.score += 1000
+			g.audio.SetMuted(!g.audio.Muted())
 		}
 	} else {
-		g.heldKeys[pixelgl.KeyP] = false
+		g.heldKeys[pixelgl.KeyM] = false
+	}
+
+	// Press i to toggle demo mode, where the autopilot flies the ship.
+	if g.stage.win.Pressed(pixelgl.KeyI) {
+		if !g.heldKeys[pixelgl.KeyI] {
+			g.heldKeys[pixelgl.KeyI] = true
+
+			g.demo = !g.demo
+			for _, ship := range g.stage.FindActorsByKind("ship") {
+				ship := ship.(*Ship)
+				ship.controller = g.shipController(ship.player)
+			}
+		}
+	} else {
+		g.heldKeys[pixelgl.KeyI] = false
 	}
 
-	// If the ship has been destroyed spawn a new one until all are gone.
-	if stage.FindActorsByKind("ship") == nil {
-		g.lives--
-		if g.lives > 0 {
-			// TODO: wait for the area near the ship to be clear before spawning
-			makeShip(g)
-		} else {
-			// TODO: game over
-			g.reset()
+	// Press h to switch the ship's special between hyperspace and shields.
+	if g.stage.win.Pressed(pixelgl.KeyH) {
+		if !g.heldKeys[pixelgl.KeyH] {
+			g.heldKeys[pixelgl.KeyH] = true
+
+			if g.special == HyperspaceSpecial {
+				g.special = ShieldSpecial
+			} else {
+				g.special = HyperspaceSpecial
+			}
 		}
+	} else {
+		g.heldKeys[pixelgl.KeyH] = false
 	}
 
-	// If all rocks have been destroyed go to the next level.
-	if stage.FindActorsByKind("rock") == nil {
-		g.newLevel(g.level + 1)
+	// Press n to cycle through the weapons ships start with.
+	if g.stage.win.Pressed(pixelgl.KeyN) {
+		if !g.heldKeys[pixelgl.KeyN] {
+			g.heldKeys[pixelgl.KeyN] = true
+
+			for i, t := range weaponTypes {
+				if t.name == g.weapon {
+					g.weapon = weaponTypes[(i+1)%len(weaponTypes)].name
+					break
+				}
+			}
+			for _, ship := range g.stage.FindActorsByKind("ship") {
+				ship.(*Ship).resetWeapon()
+			}
+		}
+	} else {
+		g.heldKeys[pixelgl.KeyN] = false
 	}
 
-	// If the player has crossed a scoring threshold give them another ship.
-	if g.previousScore%g.newShipPoints > g.score%g.newShipPoints {
-		g.lives++
+	// Press F5 to quicksave the game in play.
+	if g.stage.win.Pressed(pixelgl.KeyF5) {
+		if !g.heldKeys[pixelgl.KeyF5] {
+			g.heldKeys[pixelgl.KeyF5] = true
+
+			if g.state == PlayingState {
+				if err := writeSaveFile(g.quicksavePath, g.save()); err != nil {
+					log.Printf("Quicksave failed: %v", err)
+				} else {
+					log.Printf("Saved the game to %v", g.quicksavePath)
+				}
+			}
+		}
+	} else {
+		g.heldKeys[pixelgl.KeyF5] = false
 	}
 
-	g.previousScore = g.score
+	// Press F9 to load the quicksave.
+	if g.stage.win.Pressed(pixelgl.KeyF9) {
+		if !g.heldKeys[pixelgl.KeyF9] {
+			g.heldKeys[pixelgl.KeyF9] = true
+
+			file, err := readSaveFile(g.quicksavePath)
+			if err == nil {
+				err = g.load(file)
+			}
+			if err != nil {
+				log.Printf("Quickload failed: %v", err)
+			}
+		}
+	} else {
+		g.heldKeys[pixelgl.KeyF9] = false
+	}
 
-	// Give every actor a chance to update.
-	stage.Update(dt)
+	// Press p to add 1,000 points to the score.
+	if g.stage.win.Pressed(pixelgl.KeyP) {
+		if !g.heldKeys[pixelgl.KeyP] {
+			g.heldKeys[pixelgl.KeyP] = true
 
-	// Ask every actor to draw.
-	stage.Draw()
+			g.player.score += 1000
+		}
+	} else {
+		g.heldKeys[pixelgl.KeyP] = false
+	}
 }
 
 // WrapAroundActor upgrades SpriteActors to wrap around screen edges when they move off them.
@@ -145,15 +402,16 @@ func (a *WrapAroundActor) Draw() {
 }
 */
 
-// Score displays the current game score.
+// Score displays a player's score. With several players each has a column of the HUD.
 type Score struct {
 	TextActor
-	game *Game // TODO: retain game instead of stage in all actors?
+	game   *Game // TODO: retain game instead of stage in all actors?
+	player *Player
 }
 
-func makeScore(game *Game) *Score {
+func makeScore(game *Game, player *Player) *Score {
 	stage := game.stage
-	s := Score{TextActor: MakeTextActor(pixel.V(0, stage.bounds.Max.Y-30), stage), game: game}
+	s := Score{TextActor: MakeTextActor(pixel.V(game.hudColumn(player), stage.bounds.Max.Y-30), stage), game: game, player: player}
 	s.scale = 2
 	s.horizontalAlignment = "center"
 
@@ -161,140 +419,37 @@ func makeScore(game *Game) *Score {
 	return &s
 }
 
-// Update the Score's TextActor with the current game score.
+// Update the Score's TextActor with the player's score.
 func (a *Score) Update(dt float64) {
-	a.SetText(fmt.Sprintf("%v", a.game.score))
+	a.SetText(fmt.Sprintf("%v", a.player.score))
 	a.TextActor.Update(dt)
 }
 
-// Lives displays how many lives the player has left.
-type Lives struct {
-	BaseActor
-	game *Game
-}
-
-func makeLives(game *Game) *Lives {
-	stage := game.stage
-	l := Lives{BaseActor: MakeBaseActor(stage, "lives"), game: game}
-	l.position = pixel.V(stage.bounds.Min.X+20, stage.bounds.Max.Y-25)
-
-	stage.AddActor(&l)
-	return &l
-}
-
-// Draw a representation of the number of lives the player currently has.
-func (a *Lives) Draw() {
-	// Reuse the sprite the Ship object has.
-	ships := a.stage.FindActorsByKind("ship")
-	if len(ships) == 0 {
-		return
-	}
-	ship := ships[0].(*Ship)
-	for i := 0; i < a.game.lives; i++ {
-		ship.sprite.Draw(a.stage.win, a.Transform().Moved(pixel.V(float64(i)*30.0, 0)))
-	}
-}
-
-// Ship is the hero. It handles the UI for the player ship.
-type Ship struct {
-	WrapAroundActor
-	game         *Game
-	acceleration float64
-	rotateSpeed  float64
-	fireCooldown float64
-}
-
-func makeShip(game *Game) *Ship {
-	stage := game.stage
-	s := Ship{
-		WrapAroundActor: makeWrapAroundActor(8, stage, "ship"),
-		acceleration:    10.0,
-		rotateSpeed:     5.0,
-		fireCooldown:    0.0,
-		game:            game}
-	s.scale = 1.5
-
-	stage.AddActor(&s)
-	return &s
-}
-
-// Update responds to player input for moving and firing.
-// It also handles collision detection and response.
-func (s *Ship) Update(dt float64) {
-	stage := s.stage
-	win := stage.win
-
-	s.fireCooldown -= dt
-
-	if win.Pressed(pixelgl.KeyA) || win.Pressed(pixelgl.KeyLeft) {
-		s.rotateLeft(dt)
-	}
-
-	if win.Pressed(pixelgl.KeyD) || win.Pressed(pixelgl.KeyRight) {
-		s.rotateRight(dt)
-	}
-
-	if win.Pressed(pixelgl.KeyW) || win.Pressed(pixelgl.KeyUp) {
-		s.thrust(dt)
-	}
-
-	if s.fireCooldown <= 0.0 && (win.Pressed(pixelgl.KeyS) || win.Pressed(pixelgl.KeyDown) || win.Pressed(pixelgl.KeySpace)) {
-		// Limit the firing rate.
-		s.fireCooldown = 0.1
-
-		vector := pixel.Unit(s.rotation + math.Pi/2)
-		position := s.position.Add(vector.Scaled(25))
-		velocity := s.velocity.Add(vector.Scaled(5))
-		makeShot(position, velocity, stage, s.game)
-	}
-
-	s.WrapAroundActor.Update(dt)
-
-	// Check for collision with a rock.
-	for _, actor := range stage.actors {
-		if actor.Kind() == "rock" && intersects(s, actor) {
-			stage.RemoveActor(s)
-
-			// TODO: explode ship
-
-			rock := actor.(*Rock)
-			rock.subdivide()
-			break
-		}
-	}
-}
-
-func (s *Ship) thrust(dt float64) {
-	s.velocity = s.velocity.Add(pixel.Unit(s.rotation + math.Pi/2).Scaled(s.acceleration * dt))
-}
-
-func (s *Ship) rotateLeft(dt float64) {
-	s.rotation += s.rotateSpeed * dt
-}
-
-func (s *Ship) rotateRight(dt float64) {
-	s.rotation -= s.rotateSpeed * dt
-}
+// rockScales is how much a Rock of each generation is scaled up from its outline.
+var rockScales = []float64{5.0, 3.0, 1.5}
 
-// Rock is the primary antagonist.
+// Rock is the primary antagonist. Its outline is procedurally generated.
 type Rock struct {
-	WrapAroundActor
+	BaseActor
 	generation int
 	game       *Game
+	shape      RockShape
+	imd        *imdraw.IMDraw
+	destroyed  bool // Removed by being shot or rammed, not just put aside.
 }
 
-func makeRock(game *Game, generation int, parent *Rock) *Rock {
+// makeRock creates a Rock of the given generation. If shape is nil a new one is generated.
+func makeRock(game *Game, generation int, shape *RockShape) *Rock {
 	stage := game.stage
-	frame := rand.Intn(8)
-	rock := Rock{WrapAroundActor: makeWrapAroundActor(frame, stage, "rock"), generation: generation, game: game}
-	if parent != nil {
-		// TODO: something better
-		picture := rock.SpriteActor.sprite.Picture()
-		rock.SpriteActor.sprite.Set(picture, parent.SpriteActor.sprite.Frame())
+	rock := Rock{BaseActor: MakeBaseActor(stage, "rock"), generation: generation, game: game, imd: imdraw.New(nil)}
+	if shape != nil {
+		rock.shape = *shape
+	} else {
+		rock.shape = generateRockShape(rand.Int63(), rockShapeParamsFor(generation))
 	}
 
 	// Scale the rock according to its generation.
-	rock.scale = []float64{5.0, 3.0, 1.5}[generation-1]
+	rock.scale = rockScales[generation-1]
 
 	// Pick a random spin direction.
 	rock.rotationVelocity = 0.5
@@ -302,9 +457,9 @@ func makeRock(game *Game, generation int, parent *Rock) *Rock {
 		rock.rotationVelocity = -0.5
 	}
 
-	// Pick a random orentation.
+	// Pick a random orentation and a speed suited to the level and the rock's size.
 	angle := (math.Pi * 2) * rand.Float64()
-	rock.velocity = pixel.Unit(angle)
+	rock.velocity = pixel.Unit(angle).Scaled(game.levelParams.rockSpeeds[generation-1].random())
 
 	// Pick a random position.
 	// TODO: not cool to spawn on top or close to the ship
@@ -318,31 +473,136 @@ func makeRock(game *Game, generation int, parent *Rock) *Rock {
 	return &rock
 }
 
-func (r *Rock) subdivide() {
+func (r *Rock) Bounds() pixel.Rect {
+	return r.shape.Bounds()
+}
+
+func (r *Rock) ScaledBounds() pixel.Rect {
+	bounds := r.shape.Bounds()
+	return pixel.Rect{Min: bounds.Min.Scaled(r.scale).Add(r.position), Max: bounds.Max.Scaled(r.scale).Add(r.position)}
+}
+
+// CollisionPolygon returns the convex hull of the Rock's outline.
+func (r *Rock) CollisionPolygon() Polygon {
+	return r.shape.collision
+}
+
+// Update moves the Rock, wrapping around the screen edges.
+func (r *Rock) Update(dt float64) {
+	r.BaseActor.Update(dt)
+	wrapAroundVec(&r.position, &r.stage.bounds)
+}
+
+// Draw the Rock's outline.
+func (r *Rock) Draw() {
+	transform := r.Transform()
+	r.imd.Clear()
+	r.imd.Push(projectPolygon(&r.shape.outline, &transform)...)
+	r.imd.Polygon(2)
+	r.imd.Draw(r.stage.win)
+}
+
+// subdivide destroys the Rock, replacing it with smaller ones unless it is already the smallest.
+// by is the Actor that hit it. The smaller Rocks are returned.
+func (r *Rock) subdivide(by Actor) []*Rock {
 	game := r.game
 	stage := r.stage
 
-	points := []int{game.largeRockPoints, game.mediumRockPoints, game.smallRockPoints}
-	game.score += points[r.generation-1]
-
+	r.destroyed = true
 	stage.RemoveActor(r)
 
-	// TODO: explode rock
+	points := []int{game.largeRockPoints, game.mediumRockPoints, game.smallRockPoints}
+	game.events.PublishRockDestroyed(RockDestroyed{Rock: r, By: by, Points: points[r.generation-1]})
+
+	if rand.Float64() < game.powerUpChance {
+		makePowerUp(game, randomPowerUpType(), r.position)
+	}
 
-	// Create two smaller rocks.
+	// Break into smaller rocks that look like pieces of this one and fly apart from where it was hit.
+	var pieces []*Rock
 	if r.generation < 3 {
-		for i := 0; i < 2; i++ {
-			newRock := makeRock(game, r.generation+1, r)
-			newRock.position = r.Position()
+		shapes, offsets := fragmentRockShape(r.shape, game.rockFragments, rockShapeParamsFor(r.generation+1))
+		transform := r.Transform()
+		impact := pixel.ZV
+		if by != nil {
+			impact = by.Velocity().Scaled(game.impactTransfer)
+		}
+		speeds := game.levelParams.rockSpeeds[r.generation]
+		velocities := r.fragmentVelocities(impact, offsets, speeds)
+		for i := range shapes {
+			newRock := makeRock(game, r.generation+1, &shapes[i])
+			newRock.position = transform.Project(offsets[i])
+			newRock.rotation = r.rotation
+			newRock.velocity = velocities[i]
+			pieces = append(pieces, newRock)
+		}
+	}
+	return pieces
+}
+
+// debrisLifetime is how many seconds the specks of an exploded Rock fly for.
+const debrisLifetime = 0.6
+
+// OnRemoved leaves an explosion where a destroyed Rock was: a speck flying out from each point of its
+// outline.
+func (r *Rock) OnRemoved() {
+	if !r.destroyed {
+		return
+	}
+	stage := r.stage
+	transform := r.Transform()
+	for _, vertex := range r.shape.outline {
+		position := transform.Project(vertex)
+		e := stage.AddEntity("debris")
+		stage.AddTransform(e, Transform{position: position, scale: 0.2})
+		stage.AddVelocity(e, Velocity{linear: r.velocity.Add(position.Sub(r.position).Unit().Scaled(1.5)), angular: 4})
+		stage.AddSprite(e, makeSprite(stage, 6))
+		stage.AddWrap(e)
+		stage.AddLifetime(e, Lifetime{remaining: debrisLifetime})
+	}
+}
+
+// fragmentVelocities returns a velocity for each piece of the Rock. Pieces inherit the Rock's velocity
+// plus the impact, then fan out across fragmentSpread, each heading toward the side it broke off from.
+// Speeds are kept within the pieces' generation's range so smaller rocks move faster.
+func (r *Rock) fragmentVelocities(impact pixel.Vec, offsets []pixel.Vec, speeds SpeedRange) []pixel.Vec {
+	base := r.velocity.Add(impact)
+	heading := base.Angle()
+	if base.Len() == 0 {
+		heading = (math.Pi * 2) * rand.Float64()
+	}
+
+	// Order the pieces by which side of the heading they're on so the fan doesn't cross over itself.
+	count := len(offsets)
+	order := make([]int, count)
+	for i := range order {
+		order[i] = i
+	}
+	side := func(i int) float64 {
+		return math.Remainder(offsets[i].Rotated(r.rotation).Angle()-heading, math.Pi*2)
+	}
+	sort.Slice(order, func(a, b int) bool { return side(order[a]) < side(order[b]) })
+
+	velocities := make([]pixel.Vec, count)
+	for rank, i := range order {
+		angle := heading
+		if count > 1 {
+			angle += r.game.fragmentSpread * (float64(rank)/float64(count-1) - 0.5)
 		}
+		speed := math.Max(speeds.min, math.Min(speeds.max, base.Len()*(1+0.3*rand.Float64())))
+		velocities[i] = pixel.Unit(angle).Scaled(speed)
 	}
+	return velocities
 }
 
 // Shot is the ship's shot. It handles collision detection and response.
 type Shot struct {
 	WrapAroundActor
 	game    *Game
+	shooter *Ship
 	timeout float64
+	pierce  int            // How many more Rocks the Shot can pass through.
+	ignore  map[*Rock]bool // Pieces of Rocks this Shot pierced, so it doesn't hit them immediately.
 }
 
 func makeShot(position pixel.Vec, velocity pixel.Vec, stage *Stage, game *Game) *Shot {
@@ -356,6 +616,10 @@ func makeShot(position pixel.Vec, velocity pixel.Vec, stage *Stage, game *Game)
 	return &s
 }
 
+func (s *Shot) Shooter() *Ship {
+	return s.shooter
+}
+
 // Update handles shot-rock collision detection and response.
 func (s *Shot) Update(dt float64) {
 	stage := s.stage
@@ -368,14 +632,29 @@ func (s *Shot) Update(dt float64) {
 
 	s.WrapAroundActor.Update(dt)
 
-	// Check for collision with a rock.
-	actors := stage.actors
-	for _, actor := range actors {
-		if actor.Kind() == "rock" && intersects(actor, s) {
-			stage.RemoveActor(s)
+	if ship := friendlyFireTarget(s.game, s, s.shooter); ship != nil {
+		stage.RemoveActor(s)
+		ship.hit(s)
+		return
+	}
 
+	// Check for collision with a rock.
+	for _, actor := range stage.FindActorsByKind("rock") {
+		if !s.ignore[actor.(*Rock)] && intersects(actor, s) {
 			rock := actor.(*Rock)
-			rock.subdivide()
+			if s.pierce <= 0 {
+				stage.RemoveActor(s)
+				rock.subdivide(s)
+				break
+			}
+
+			s.pierce--
+			if s.ignore == nil {
+				s.ignore = make(map[*Rock]bool)
+			}
+			for _, piece := range rock.subdivide(s) {
+				s.ignore[piece] = true
+			}
 			break
 		}
 	}
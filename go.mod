@@ -3,6 +3,7 @@ module massena.com/gorocks
 go 1.15
 
 require (
+	github.com/faiface/beep v1.0.2
 	github.com/faiface/pixel v0.10.0
 	golang.org/x/image v0.0.0-20201208152932-35266b937fa6
 )
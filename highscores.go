@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxHighScores is how many scores the high-score table keeps.
+const maxHighScores = 10
+
+// HighScore is an entry in the high-score table.
+type HighScore struct {
+	score int
+	level int
+}
+
+// recordHighScore adds the score to the table if it is high enough. Scores are kept for the session.
+func (g *Game) recordHighScore(score int, level int) {
+	if score <= 0 {
+		return
+	}
+	g.highScores = append(g.highScores, HighScore{score: score, level: level})
+	sort.SliceStable(g.highScores, func(i, j int) bool { return g.highScores[i].score > g.highScores[j].score })
+	if len(g.highScores) > maxHighScores {
+		g.highScores = g.highScores[:maxHighScores]
+	}
+}
+
+// formatHighScores returns the high-score table as text, one line per entry.
+func (g *Game) formatHighScores() string {
+	if len(g.highScores) == 0 {
+		return "NO SCORES YET"
+	}
+	var lines []string
+	for i, entry := range g.highScores {
+		lines = append(lines, fmt.Sprintf("%2d. %7d  WAVE %v", i+1, entry.score, entry.level))
+	}
+	return strings.Join(lines, "\n")
+}
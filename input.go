@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// Actions is the set of things a Ship is asked to do in a frame. The Ship doesn't care whether
+// they come from the keyboard, the autopilot, or anything else.
+type Actions uint8
+
+const (
+	TurnLeft Actions = 1 << iota
+	TurnRight
+	Thrust
+	Fire
+	Special // Hyperspace or shields, depending on Game.special.
+)
+
+// Has reports whether all of the given Actions are requested.
+func (a Actions) Has(actions Actions) bool {
+	return a&actions == actions
+}
+
+// Controller decides what a Ship does each frame.
+type Controller interface {
+	Actions(ship *Ship) Actions
+}
+
+// KeyBindings maps each Action to the keys that trigger it.
+type KeyBindings map[Actions][]pixelgl.Button
+
+var defaultKeyBindings = KeyBindings{
+	TurnLeft:  {pixelgl.KeyA, pixelgl.KeyLeft},
+	TurnRight: {pixelgl.KeyD, pixelgl.KeyRight},
+	Thrust:    {pixelgl.KeyW, pixelgl.KeyUp},
+	Fire:      {pixelgl.KeyS, pixelgl.KeyDown, pixelgl.KeySpace},
+	Special:   {pixelgl.KeyLeftShift, pixelgl.KeyRightShift},
+}
+
+// coopKeyBindings split the keyboard between two players in co-op: WASD and arrows.
+var coopKeyBindings = []KeyBindings{
+	{
+		TurnLeft:  {pixelgl.KeyA},
+		TurnRight: {pixelgl.KeyD},
+		Thrust:    {pixelgl.KeyW},
+		Fire:      {pixelgl.KeyS, pixelgl.KeySpace},
+		Special:   {pixelgl.KeyLeftShift},
+	},
+	{
+		TurnLeft:  {pixelgl.KeyLeft},
+		TurnRight: {pixelgl.KeyRight},
+		Thrust:    {pixelgl.KeyUp},
+		Fire:      {pixelgl.KeyDown, pixelgl.KeyRightControl},
+		Special:   {pixelgl.KeyRightShift},
+	},
+}
+
+// KeyboardController reads Actions from the window's keyboard.
+type KeyboardController struct {
+	win      *pixelgl.Window
+	bindings KeyBindings
+}
+
+func makeKeyboardController(win *pixelgl.Window, bindings KeyBindings) *KeyboardController {
+	return &KeyboardController{win: win, bindings: bindings}
+}
+
+func (c *KeyboardController) Actions(ship *Ship) Actions {
+	var actions Actions
+	for action, keys := range c.bindings {
+		for _, key := range keys {
+			if c.win.Pressed(key) {
+				actions |= action
+				break
+			}
+		}
+	}
+	return actions
+}
+
+// GamepadController reads Actions from a gamepad: the left stick or d-pad turns and thrusts,
+// A or the right bumper fires, and X or the left bumper is the special.
+type GamepadController struct {
+	win      *pixelgl.Window
+	joystick pixelgl.Joystick
+	deadZone float64 // Stick deflection ignored, 0..1.
+}
+
+func makeGamepadController(win *pixelgl.Window, joystick pixelgl.Joystick) *GamepadController {
+	return &GamepadController{win: win, joystick: joystick, deadZone: 0.4}
+}
+
+func (c *GamepadController) Actions(ship *Ship) Actions {
+	win, js := c.win, c.joystick
+	if !win.JoystickPresent(js) {
+		return 0
+	}
+
+	var actions Actions
+	x, y := win.JoystickAxis(js, pixelgl.AxisLeftX), win.JoystickAxis(js, pixelgl.AxisLeftY)
+	if x < -c.deadZone || win.JoystickPressed(js, pixelgl.ButtonDpadLeft) {
+		actions |= TurnLeft
+	}
+	if x > c.deadZone || win.JoystickPressed(js, pixelgl.ButtonDpadRight) {
+		actions |= TurnRight
+	}
+	// Up is negative on the stick.
+	if y < -c.deadZone || win.JoystickPressed(js, pixelgl.ButtonDpadUp) {
+		actions |= Thrust
+	}
+	if win.JoystickPressed(js, pixelgl.ButtonA) || win.JoystickPressed(js, pixelgl.ButtonRightBumper) {
+		actions |= Fire
+	}
+	if win.JoystickPressed(js, pixelgl.ButtonX) || win.JoystickPressed(js, pixelgl.ButtonLeftBumper) {
+		actions |= Special
+	}
+	return actions
+}
+
+// Controllers combines Controllers, e.g. a player's keys and gamepad, requesting every Action any of them does.
+type Controllers []Controller
+
+func (c Controllers) Actions(ship *Ship) Actions {
+	var actions Actions
+	for _, controller := range c {
+		actions |= controller.Actions(ship)
+	}
+	return actions
+}
+
+// anyKeyJustPressed reports whether any keyboard key went down this frame.
+func anyKeyJustPressed(win *pixelgl.Window) bool {
+	for key := pixelgl.KeySpace; key <= pixelgl.KeyLast; key++ {
+		if win.JustPressed(key) {
+			return true
+		}
+	}
+	return false
+}
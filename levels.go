@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+)
+
+// SpeedRange bounds a random speed, in pixels per frame like all velocities.
+type SpeedRange struct {
+	min float64
+	max float64
+}
+
+// random returns a speed uniformly distributed within the range.
+func (r SpeedRange) random() float64 {
+	return r.min + (r.max-r.min)*rand.Float64()
+}
+
+// LevelParams defines the difficulty of one level (wave).
+type LevelParams struct {
+	rocks       int           // Number of large rocks the level starts with.
+	rockSpeeds  [3]SpeedRange // Indexed by generation-1.
+	beatSlowest float64       // Seconds between heartbeats when the level starts.
+	beatFastest float64       // Seconds between heartbeats when the last rock is almost gone.
+}
+
+// levels defines the first few levels. Later levels are extrapolated from the last one by levelParams.
+var levels = []LevelParams{
+	{rocks: 4, rockSpeeds: [3]SpeedRange{{0.5, 1.0}, {0.8, 1.5}, {1.1, 2.0}}, beatSlowest: 1.0, beatFastest: 0.3},
+	{rocks: 6, rockSpeeds: [3]SpeedRange{{0.6, 1.1}, {0.9, 1.6}, {1.2, 2.2}}, beatSlowest: 0.95, beatFastest: 0.28},
+	{rocks: 8, rockSpeeds: [3]SpeedRange{{0.7, 1.2}, {1.0, 1.8}, {1.3, 2.4}}, beatSlowest: 0.9, beatFastest: 0.25},
+	{rocks: 10, rockSpeeds: [3]SpeedRange{{0.8, 1.3}, {1.1, 2.0}, {1.4, 2.6}}, beatSlowest: 0.85, beatFastest: 0.22},
+}
+
+// Extrapolation limits for levels beyond those defined.
+const (
+	maxLevelRocks      = 12
+	levelSpeedGrowth   = 1.05 // Rock speeds are multiplied by this per extra level...
+	maxLevelSpeedScale = 1.5  // ...up to this much faster than the last defined level.
+	minBeatFastest     = 0.15
+)
+
+// levelParams returns the definition of the given level (1-based).
+func levelParams(level int) LevelParams {
+	if level <= len(levels) {
+		return levels[level-1]
+	}
+
+	params := levels[len(levels)-1]
+	extra := float64(level - len(levels))
+
+	params.rocks = int(math.Min(maxLevelRocks, float64(params.rocks)+extra))
+
+	speedScale := math.Min(maxLevelSpeedScale, math.Pow(levelSpeedGrowth, extra))
+	for i := range params.rockSpeeds {
+		params.rockSpeeds[i].min *= speedScale
+		params.rockSpeeds[i].max *= speedScale
+	}
+
+	params.beatFastest = math.Max(minBeatFastest, params.beatFastest*math.Pow(0.97, extra))
+	return params
+}
+
+// setLevel makes level the current player's level and applies its parameters, without starting it.
+// Co-op players share their level.
+func (g *Game) setLevel(level int) {
+	g.player.level = level
+	if g.coop {
+		for _, player := range g.players {
+			player.level = level
+		}
+	}
+	g.levelParams = levelParams(level)
+	g.levelRocks = g.levelParams.rocks * g.rockDescendants(1)
+	g.heartbeat.slowest = g.levelParams.beatSlowest
+	g.heartbeat.fastest = g.levelParams.beatFastest
+	g.heartbeat.Reset()
+}
+
+// newLevel starts an intermission announcing the level. Its rocks appear when the intermission ends.
+func (g *Game) newLevel(level int) {
+	g.setLevel(level)
+
+	g.intermission = g.intermissionLength
+	g.waveBanner = makeWaveBanner(g)
+}
+
+// startLevel ends the intermission and spawns the level's rocks.
+func (g *Game) startLevel() {
+	g.intermission = 0
+	g.stage.RemoveActor(g.waveBanner)
+	g.waveBanner = nil
+
+	for i := 0; i < g.levelParams.rocks; i++ {
+		makeRock(g, 1, nil)
+	}
+	g.heartbeat.Reset()
+}
+
+// makeWaveBanner shows "WAVE N" in the middle of the screen.
+func makeWaveBanner(game *Game) *TextActor {
+	t := MakeTextActor(pixel.ZV, game.stage)
+	t.scale = 3
+	t.horizontalAlignment = "center"
+	t.SetText(fmt.Sprintf("WAVE %v", game.player.level))
+
+	game.stage.AddActor(&t)
+	return &t
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// awardExtraLives gives each player a ship for every newShipPoints threshold their score has
+// passed, however many were crossed since the last check. Lives never exceed maxLives; thresholds
+// passed while at the cap are forfeited.
+func (g *Game) awardExtraLives() {
+	for _, player := range g.players {
+		for player.score >= player.nextShipScore {
+			player.nextShipScore += g.newShipPoints
+			g.addLife(player)
+		}
+	}
+}
+
+// addLife gives the player another ship, unless they already have maxLives. With shared lives it
+// goes to the pool.
+func (g *Game) addLife(player *Player) {
+	player = g.livesPool(player)
+	if player.lives < g.maxLives {
+		player.lives++
+		g.events.PublishExtraLife(ExtraLife{Lives: player.lives})
+	}
+}
+
+// Lives displays how many lives a player has left. A newly awarded life blinks and
+// shrinks into place.
+type Lives struct {
+	BaseActor
+	game        *Game
+	player      *Player
+	sprite      *pixel.Sprite
+	shown       int     // The number of lives as of the last Update.
+	awardTimer  float64 // Counts down while the newest life is animating.
+	awardLength float64
+}
+
+func makeLives(game *Game, player *Player) *Lives {
+	stage := game.stage
+	l := Lives{BaseActor: MakeBaseActor(stage, "lives"), game: game, player: player, shown: player.lives, awardLength: 1.0}
+	l.sprite = pixel.NewSprite(stage.spritesheet, stage.frames[shipFrame])
+	l.position = pixel.V(stage.bounds.Min.X+20, stage.bounds.Max.Y-25)
+	if len(game.players) > 1 {
+		l.position = pixel.V(game.hudColumn(player)-45, stage.bounds.Max.Y-60)
+	}
+
+	stage.AddActor(&l)
+	return &l
+}
+
+// Update starts the award animation when the number of lives goes up.
+func (a *Lives) Update(dt float64) {
+	if a.player.lives > a.shown {
+		a.awardTimer = a.awardLength
+	}
+	a.shown = a.player.lives
+	a.awardTimer = math.Max(0, a.awardTimer-dt)
+}
+
+// Draw a representation of the number of lives the player currently has.
+func (a *Lives) Draw() {
+	for i := 0; i < a.player.lives; i++ {
+		transform := a.Transform().Moved(pixel.V(float64(i)*30.0, 0))
+
+		if i == a.player.lives-1 && a.awardTimer > 0 {
+			// Blink five times a second while shrinking from double size.
+			if int(a.awardTimer*10)%2 == 1 {
+				continue
+			}
+			progress := a.awardTimer / a.awardLength
+			transform = pixel.IM.Scaled(pixel.ZV, 1+progress).Chained(transform)
+		}
+
+		a.sprite.Draw(a.stage.win, transform)
+	}
+}
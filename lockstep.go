@@ -0,0 +1,421 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+	"golang.org/x/image/colornames"
+)
+
+// Lockstep play is an alternative to the snapshot server: every peer simulates the whole co-op
+// Game and they exchange only their inputs. To keep the game responsive a peer doesn't wait for the
+// others' inputs. It predicts they are the same as the last received and, when one turns out
+// different, rolls the Game back to the frame it was for and simulates again with the right ones.
+//
+// This only works if the simulation is deterministic. Peers start from the same seed, the random
+// numbers of every frame are seeded from it and the frame number, and frames have a fixed length.
+// They must run the same build on the same kind of CPU, and with the same game flags. Peers compare
+// a hash of the Game every frame to catch them drifting apart.
+const (
+	rollbackFrames     = 12  // Most frames a peer simulates ahead of the inputs it has. Further ahead, it waits.
+	lockstepInputDelay = 2   // Frames local input is held back, so that fewer remote inputs arrive late.
+	lockstepHashFrames = 120 // Frames of final hashes kept for comparing with peers' hashes that arrive late.
+	lockstepSyncEvery  = 60  // Frames between checks for a peer being ahead of the others.
+	lockstepMaxInputs  = 64  // Most inputs in a packet.
+)
+
+const lockstepPacket uint8 = 3
+
+// LockstepSession plays a co-op Game with peers, a player each.
+type LockstepSession struct {
+	conn        net.PacketConn
+	peers       []net.Addr // By player number - 1. nil for the local player.
+	local       int        // The local player's number.
+	seed        int64
+	game        *Game
+	controllers []*actionsController
+	controller  Controller // The local player's input.
+	packets     chan netPacket
+
+	frame     int         // The next frame to simulate.
+	inputs    [][]Actions // Per player, by frame, as far as they are known.
+	used      [][]Actions // Per player, the inputs each frame was simulated with, predicted or not.
+	rollback  int         // The earliest frame simulated with a wrong prediction, or -1.
+	saved     map[int]*savedGame
+	heard     []bool // Per player, whether they have been heard from.
+	acked     []int  // Per player, how many of the local inputs they have.
+	peerFrame []int  // Per player, the frame they last reported simulating.
+	peerAhead []int  // Per player, how many frames they last reported being ahead of the local peer.
+	wait      int    // Frames to wait for the others to catch up.
+	clock     float64
+
+	hashes     map[int]uint32 // Local hashes, by frame.
+	peerHashes map[int]uint32 // Peers' final hashes not yet final here, by frame.
+	hashFrame  int            // The newest frame with a final hash, or -1.
+	desynced   bool
+}
+
+func makeLockstepSession(conn net.PacketConn, peers []net.Addr, local int, seed int64, stage *Stage,
+	audio *Audio, controller Controller) *LockstepSession {
+	players := len(peers)
+	s := &LockstepSession{conn: conn, peers: peers, local: local, seed: seed, controller: controller,
+		packets: make(chan netPacket, 256), rollback: -1, saved: make(map[int]*savedGame),
+		inputs: make([][]Actions, players), used: make([][]Actions, players), heard: make([]bool, players),
+		acked: make([]int, players), peerFrame: make([]int, players), peerAhead: make([]int, players),
+		hashes: make(map[int]uint32), peerHashes: make(map[int]uint32), hashFrame: -1}
+	s.heard[local-1] = true
+
+	// The local input is delayed by starting it a few frames in.
+	s.inputs[local-1] = make([]Actions, lockstepInputDelay)
+
+	rand.Seed(seed)
+	s.game = makeGame(stage, audio, nil)
+	for i := 0; i < players; i++ {
+		s.controllers = append(s.controllers, &actionsController{})
+		s.game.controllers = append(s.game.controllers, s.controllers[i])
+	}
+	s.game.friendlyFire = *friendlyFire
+	s.game.sharedLives = *sharedLives
+	s.game.startGame(PlayingState, players, true)
+
+	go readPackets(conn, s.packets)
+	return s
+}
+
+// runLockstep plays with the peers at addrs, in player order, as the given player until the window
+// is closed.
+func runLockstep(addrs []string, local int, seed int64, conditions NetConditions) {
+	if local < 1 || local > len(addrs) {
+		log.Fatalf("Player %v isn't one of the %v peers", local, len(addrs))
+	}
+	peers := make([]net.Addr, len(addrs))
+	for i, addr := range addrs {
+		if i+1 == local {
+			continue
+		}
+		peer, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		peers[i] = peer
+	}
+	conn, err := listenNet(addrs[local-1], conditions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	win, err := pixelgl.NewWindow(pixelgl.WindowConfig{Title: "Go Rocks!", Bounds: screenBounds, VSync: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	win.SetMatrix(pixel.IM.Moved(win.Bounds().Center()))
+	stage, err := makeGameStage(win)
+	if err != nil {
+		log.Fatal(err)
+	}
+	audio := MakeAudio(nullAudioBackend{})
+	if speakerBackend, err := newBeepAudioBackend(44100); err == nil {
+		audio = MakeAudio(speakerBackend)
+		audio.LoadSounds()
+	}
+
+	session := makeLockstepSession(conn, peers, local, seed, &stage, &audio, makeKeyboardController(win, defaultKeyBindings))
+	banner := MakeTextActor(pixel.V(0, 150), &stage)
+	banner.scale = 3
+	banner.horizontalAlignment = "center"
+
+	last := time.Now()
+	for !win.Closed() {
+		dt := time.Since(last).Seconds()
+		last = time.Now()
+
+		win.Clear(colornames.Black)
+		if err := session.update(dt); err != nil {
+			log.Fatal(err)
+		}
+		stage.Draw()
+		if waiting := session.waitingFor(); waiting != nil {
+			banner.SetText(fmt.Sprintf("WAITING FOR PLAYER %v", strings.Join(waiting, ", ")))
+			banner.Draw()
+		}
+		win.Update()
+	}
+}
+
+// update handles the packets received, then simulates frames at the fixed rate, rolling back first
+// if a prediction was wrong.
+func (s *LockstepSession) update(dt float64) error {
+	for receiving := true; receiving; {
+		select {
+		case packet := <-s.packets:
+			if packet.err != nil {
+				return packet.err
+			}
+			s.receive(packet)
+		default:
+			receiving = false
+		}
+	}
+
+	if s.rollback >= 0 {
+		if err := s.resimulate(); err != nil {
+			return err
+		}
+	}
+	s.forget()
+
+	s.clock += dt
+	for s.clock >= 1.0/netTickRate {
+		s.clock -= 1.0 / netTickRate
+		if !s.advance() {
+			// Stalled. Don't build up frames to catch up on all at once.
+			s.clock = 0
+			break
+		}
+	}
+	return nil
+}
+
+// advance simulates the next frame with the local player's newest input. It returns false if the
+// session must wait for the other peers instead.
+func (s *LockstepSession) advance() bool {
+	if s.wait > 0 {
+		s.wait--
+		return false
+	}
+	if s.frame-s.confirmed() >= rollbackFrames {
+		s.send()
+		return false
+	}
+
+	local := s.local - 1
+	s.inputs[local] = append(s.inputs[local], s.controller.Actions(nil))
+	s.simulate(s.frame)
+	s.frame++
+	s.send()
+
+	if s.frame%lockstepSyncEvery == 0 {
+		s.syncFrames()
+	}
+	return true
+}
+
+// confirmed returns the frame up to which every player's inputs are known.
+func (s *LockstepSession) confirmed() int {
+	confirmed := len(s.inputs[0])
+	for _, inputs := range s.inputs[1:] {
+		if len(inputs) < confirmed {
+			confirmed = len(inputs)
+		}
+	}
+	return confirmed
+}
+
+// input returns the player's input for the frame, predicting it from the last known if need be.
+func (s *LockstepSession) input(player int, frame int) Actions {
+	inputs := s.inputs[player]
+	switch {
+	case frame < len(inputs):
+		return inputs[frame]
+	case len(inputs) > 0:
+		return inputs[len(inputs)-1]
+	}
+	return 0
+}
+
+// simulate saves the Game, then steps it through the frame with each player's input.
+func (s *LockstepSession) simulate(frame int) {
+	s.saved[frame] = saveGame(s.game)
+	for player, controller := range s.controllers {
+		controller.actions = s.input(player, frame)
+		used := s.used[player]
+		if frame < len(used) {
+			used[frame] = controller.actions
+		} else {
+			s.used[player] = append(used, controller.actions)
+		}
+	}
+
+	rand.Seed(s.seed ^ int64(uint64(frame+1)*0x9E3779B97F4A7C15))
+	s.game.step(1.0 / netTickRate)
+
+	// The hash is final once every input up to the frame is known, as it won't be simulated again.
+	hash := s.game.stateHash()
+	s.hashes[frame] = uint32(hash ^ hash>>32)
+}
+
+// forget drops the saved states that are no longer needed, once every input for their frames is
+// known, and the oldest final hashes, and checks the final hashes against the peers'.
+func (s *LockstepSession) forget() {
+	confirmed := s.confirmed()
+	for frame := range s.saved {
+		if frame < confirmed {
+			delete(s.saved, frame)
+		}
+	}
+
+	if confirmed == 0 {
+		return
+	}
+	// Inputs may be known for frames not simulated yet.
+	s.hashFrame = confirmed - 1
+	if s.hashFrame >= s.frame {
+		s.hashFrame = s.frame - 1
+	}
+	for frame := range s.hashes {
+		if frame <= s.hashFrame-lockstepHashFrames {
+			delete(s.hashes, frame)
+		}
+	}
+	s.checkHashes()
+}
+
+// resimulate rolls back to the earliest wrongly predicted frame and simulates up to the present
+// again. What has already been heard isn't played again. It returns an error if the frame's state
+// is no longer saved, which would leave the session out of step for good.
+func (s *LockstepSession) resimulate() error {
+	saved := s.saved[s.rollback]
+	if saved == nil {
+		return fmt.Errorf("no saved state to roll back to frame %v", s.rollback)
+	}
+	saved.restoreGame()
+
+	s.game.audio.silenced = true
+	for frame := s.rollback; frame < s.frame; frame++ {
+		s.simulate(frame)
+	}
+	s.game.audio.silenced = false
+	s.rollback = -1
+	return nil
+}
+
+// receive takes the new inputs from a peer's packet, noting which were predicted wrong.
+func (s *LockstepSession) receive(packet netPacket) {
+	r := packetReader{buf: packet.data}
+	if r.u8() != lockstepPacket {
+		return
+	}
+	player := int(r.u8()) - 1
+	if player < 0 || player >= len(s.peers) || s.peers[player] == nil ||
+		s.peers[player].String() != packet.addr.String() {
+		return
+	}
+	frame := int(r.u32())
+	ahead := int(int8(r.u8()))
+	acked := int(r.u32())
+	first := int(r.u32())
+	inputs := make([]Actions, r.u8())
+	for i := range inputs {
+		inputs[i] = Actions(r.u8())
+	}
+	hashFrame, hash := int(r.u32())-1, r.u32()
+	if r.err != nil {
+		return
+	}
+
+	s.heard[player] = true
+	s.peerFrame[player] = frame
+	s.peerAhead[player] = ahead
+	if acked > s.acked[player] {
+		s.acked[player] = acked
+	}
+
+	// Inputs are resent until acknowledged, so only a gap-free continuation is needed.
+	known := s.inputs[player]
+	if first <= len(known) {
+		for i, actions := range inputs {
+			frame := first + i
+			if frame < len(known) {
+				continue
+			}
+			known = append(known, actions)
+			if frame < s.frame && s.used[player][frame] != actions && (s.rollback < 0 || frame < s.rollback) {
+				s.rollback = frame
+			}
+		}
+		s.inputs[player] = known
+	}
+
+	if hashFrame >= 0 {
+		s.peerHashes[hashFrame] = hash
+	}
+}
+
+// checkHashes compares the peers' hashes with the local ones, once those are final too. Peers' hashes
+// of frames too old to have a local hash any more are dropped.
+func (s *LockstepSession) checkHashes() {
+	for frame, remote := range s.peerHashes {
+		if frame > s.hashFrame {
+			continue
+		}
+		if local, ok := s.hashes[frame]; ok && local != remote && !s.desynced {
+			s.desynced = true
+			log.Printf("Desync at frame %v: hash %08x here, %08x on a peer", frame, local, remote)
+		}
+		delete(s.peerHashes, frame)
+	}
+}
+
+// send sends each peer the local inputs they don't have yet, and the newest hash.
+func (s *LockstepSession) send() {
+	local := s.inputs[s.local-1]
+	for player, peer := range s.peers {
+		if peer == nil {
+			continue
+		}
+		first := s.acked[player]
+		inputs := local[first:]
+		if len(inputs) > lockstepMaxInputs {
+			inputs = inputs[:lockstepMaxInputs]
+		}
+
+		w := packetWriter{}
+		w.u8(lockstepPacket)
+		w.u8(uint8(s.local))
+		w.u32(uint32(s.frame))
+		w.u8(uint8(int8(s.frame - s.peerFrame[player])))
+		w.u32(uint32(len(s.inputs[player])))
+		w.u32(uint32(first))
+		w.u8(uint8(len(inputs)))
+		for _, actions := range inputs {
+			w.u8(uint8(actions))
+		}
+		w.u32(uint32(s.hashFrame + 1))
+		w.u32(s.hashes[s.hashFrame])
+		s.conn.WriteTo(w.buf, peer)
+	}
+}
+
+// syncFrames makes a peer that has got ahead of another wait for it. Otherwise the peer behind would
+// always be rolling back, while the one ahead waits on its inputs anyway. Each measures how far
+// ahead of the other it is, which includes the latency between them, so half the difference is
+// how far ahead it really is.
+func (s *LockstepSession) syncFrames() {
+	for player, peer := range s.peers {
+		if peer == nil || !s.heard[player] {
+			continue
+		}
+		ahead := (s.frame - s.peerFrame[player] - s.peerAhead[player]) / 2
+		if ahead > s.wait {
+			s.wait = ahead
+		}
+	}
+}
+
+// waitingFor returns the players not heard from yet, or nil once everybody has been.
+func (s *LockstepSession) waitingFor() []string {
+	var waiting []string
+	for player, heard := range s.heard {
+		if !heard {
+			waiting = append(waiting, fmt.Sprint(player+1))
+		}
+	}
+	return waiting
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// makeHeadlessGame makes a Game with no window or sound.
+func makeHeadlessGame(t *testing.T) *Game {
+	t.Helper()
+	stage, err := makeGameStage(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio := MakeAudio(nullAudioBackend{})
+	return makeGame(&stage, &audio, nil)
+}
+
+// scriptedController plays the Actions a script gives for each call in turn.
+type scriptedController struct {
+	calls  int
+	script func(call int) Actions
+}
+
+func (c *scriptedController) Actions(ship *Ship) Actions {
+	c.calls++
+	return c.script(c.calls - 1)
+}
+
+// wander turns one way, then the other, thrusting and firing now and then.
+func wander(call int) Actions {
+	actions := TurnLeft
+	if call/45%2 == 1 {
+		actions = TurnRight
+	}
+	if call%20 < 8 {
+		actions |= Thrust
+	}
+	if call%7 == 0 {
+		actions |= Fire
+	}
+	return actions
+}
+
+func TestRollback(t *testing.T) {
+	game := makeHeadlessGame(t)
+	controllers := []*actionsController{{}, {}}
+	for _, controller := range controllers {
+		game.controllers = append(game.controllers, controller)
+	}
+	rand.Seed(1)
+	game.startGame(PlayingState, 2, true)
+
+	// step simulates a frame the way a LockstepSession does.
+	step := func(frame int) uint64 {
+		controllers[0].actions = wander(frame)
+		controllers[1].actions = wander(frame + 30)
+		rand.Seed(int64(frame))
+		game.step(1.0 / netTickRate)
+		return game.stateHash()
+	}
+	const saveFrame, frames = 200, 120
+	for frame := 0; frame < saveFrame; frame++ {
+		step(frame)
+	}
+	saved := saveGame(game)
+	var hashes []uint64
+	for frame := saveFrame; frame < saveFrame+frames; frame++ {
+		hashes = append(hashes, step(frame))
+	}
+	if game.stage.FindActorsByKind("shot") == nil && game.stage.FindActorsByKind("ship") == nil {
+		t.Fatal("nothing happened")
+	}
+
+	// A saved game can be restored any number of times.
+	for replay := 0; replay < 2; replay++ {
+		saved.restoreGame()
+		for i, want := range hashes {
+			frame := saveFrame + i
+			if got := step(frame); got != want {
+				t.Fatalf("replay %v: frame %v hashes %016x, %016x the first time", replay, frame, got, want)
+			}
+		}
+	}
+}
+
+func TestLockstepLoopback(t *testing.T) {
+	conditions := NetConditions{loss: 0.2}
+	var conns []net.PacketConn
+	var addrs []net.Addr
+	for i := 0; i < 2; i++ {
+		conn, err := listenNet("127.0.0.1:0", conditions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+		addrs = append(addrs, conn.LocalAddr())
+	}
+
+	var sessions []*LockstepSession
+	for i, conn := range conns {
+		peers := append([]net.Addr(nil), addrs...)
+		peers[i] = nil
+		stage, err := makeGameStage(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		audio := MakeAudio(nullAudioBackend{})
+		offset := i * 30
+		controller := &scriptedController{script: func(call int) Actions { return wander(call + offset) }}
+		sessions = append(sessions, makeLockstepSession(conn, peers, i+1, 42, &stage, &audio, controller))
+	}
+
+	// The peers predict each other's inputs wrong all the time, and lose packets, so they roll back
+	// often. They must still agree on every frame.
+	const frames = 300
+	done := func() bool {
+		for _, session := range sessions {
+			if session.hashFrame < frames {
+				return false
+			}
+		}
+		return true
+	}
+	for start := time.Now(); !done() && time.Since(start) < 20*time.Second; {
+		for _, session := range sessions {
+			if err := session.update(1.0 / netTickRate); err != nil {
+				t.Fatal(err)
+			}
+			if session.desynced {
+				t.Fatalf("player %v desynced at frame %v", session.local, session.frame)
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !done() {
+		t.Fatalf("only got to frames %v and %v", sessions[0].hashFrame, sessions[1].hashFrame)
+	}
+
+	compared := 0
+	for frame, hash := range sessions[0].hashes {
+		if other, ok := sessions[1].hashes[frame]; ok && frame <= sessions[1].hashFrame && frame <= sessions[0].hashFrame {
+			compared++
+			if hash != other {
+				t.Errorf("frame %v hashes %08x and %08x", frame, hash, other)
+			}
+		}
+	}
+	if compared == 0 {
+		t.Error("no final hashes in common")
+	}
+
+	// Frame 0's state was dropped long ago, so it can't be rolled back to.
+	sessions[0].rollback = 0
+	if err := sessions[0].update(0); err == nil {
+		t.Error("rolled back to a frame that wasn't saved")
+	}
+}
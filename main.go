@@ -1,22 +1,22 @@
 // TODO:
 // - fix unthrottled frame rate on Linux
-// - game over
-// - ship deceleration
 // - good collision detection
-// - sound effects
 // - saucers
 // - new graphics
 // - high score
-// - smaller = faster
 // - timing variability
 // - explosions
-// - safe spawning
 
 package main
 
 import (
+	"flag"
 	"image"
+	"log"
+	"math"
+	"math/rand"
 	"os"
+	"strings"
 	"time"
 
 	_ "image/png"
@@ -26,8 +26,35 @@ import (
 	"golang.org/x/image/colornames"
 )
 
+var (
+	benchGames   = flag.Int("bench", 0, "Play this many games headless with the autopilot, print the results, and exit.")
+	benchSeconds = flag.Float64("bench-seconds", 600, "Give up on a benchmarked game after this many seconds.")
+	envServer    = flag.String("env-server", "", "Serve the reinforcement learning environment on this address, e.g. localhost:5555.")
+	envObserve   = flag.String("env-observation", "features", "What the environment server observes: features or frame.")
+	coopPlayers  = flag.Int("coop-players", 2, "How many players co-op is for, up to 4. Players after the second need gamepads.")
+	friendlyFire = flag.Bool("friendly-fire", false, "In co-op, let players shoot each other.")
+	sharedLives  = flag.Bool("shared-lives", false, "In co-op, share one pool of lives between the players.")
+	netServer    = flag.String("server", "", "Run a headless game server for networked co-op on this address, e.g. :7777.")
+	netPlayers   = flag.Int("net-players", 2, "How many players the game server waits for.")
+	netConnect   = flag.String("connect", "", "Join the game server at this address, e.g. localhost:7777.")
+	lockstep     = flag.String("lockstep", "", "Play co-op peer to peer with these comma-separated addresses, one per player in order.")
+	lockstepAs   = flag.Int("lockstep-player", 1, "Which of the lockstep players this is. It listens on that player's address.")
+	netLatency   = flag.Duration("net-latency", 0, "Simulate network latency by delaying each packet sent, e.g. 50ms.")
+	netJitter    = flag.Duration("net-jitter", 0, "Simulate network jitter by delaying each packet up to this much more.")
+	netLoss      = flag.Float64("net-loss", 0, "Simulate packet loss by dropping this fraction (0..1) of the packets sent.")
+	quicksave    = flag.String("quicksave", "quicksave.sav", "The file F5 saves the game to and F9 loads it from. Use a .json name for JSON.")
+	stateLog     = flag.String("state-log", "", "Log a hash of the game's state every frame to this file, to compare runs with -diff.")
+	stateEvery   = flag.Int("state-log-every", 60, "With -state-log, also log the whole state every this many frames. 0 for never.")
+	diff         = flag.Bool("diff", false, "Compare two state logs (.jsonl) or save files given as arguments, print the differences, and exit.")
+	demo         = flag.Bool("demo", false, "Start in demo mode, with the autopilot flying the ship.")
+	seed         = flag.Int64("seed", 0, "Random seed. 0 for different random numbers every run.")
+)
+
+// screenBounds is the size of the window, and of the Stage.
+var screenBounds = pixel.R(0, 0, 1024, 768)
+
 func run() {
-	bounds := pixel.R(0, 0, 1024, 768)
+	bounds := screenBounds
 
 	cfg := pixelgl.WindowConfig{
 		Title:  "Go Rocks!",
@@ -39,28 +66,45 @@ func run() {
 		panic(err)
 	}
 
-	treesheet, treesheetImage, err := loadPicture("trees.png")
+	// TODO: do something with or remove these
+	camPos := pixel.ZV
+	camZoom := 1.0
+
+	stage, err := makeGameStage(win)
 	if err != nil {
 		panic(err)
 	}
 
-	var treeFrames []pixel.Rect
-	for x := treesheet.Bounds().Min.X; x < treesheet.Bounds().Max.X; x += 32 {
-		for y := treesheet.Bounds().Min.Y; y < treesheet.Bounds().Max.Y; y += 32 {
-			treeFrames = append(treeFrames, pixel.R(x, y, x+32, y+32))
-		}
+	var audioBackend AudioBackend = nullAudioBackend{}
+	if speakerBackend, err := newBeepAudioBackend(44100); err != nil {
+		log.Printf("Sound disabled: %v", err)
+	} else {
+		audioBackend = speakerBackend
+	}
+	audio := MakeAudio(audioBackend)
+	audio.LoadSounds()
+
+	game := makeGame(&stage, &audio, makeKeyboardController(win, defaultKeyBindings))
+	game.demo = *demo
+	game.coopPlayers = int(math.Max(1, math.Min(maxCoopPlayers, float64(*coopPlayers))))
+	game.friendlyFire = *friendlyFire
+	game.sharedLives = *sharedLives
+	game.quicksavePath = *quicksave
+	game.stateLog = openStateLogFlag()
+	if game.stateLog != nil {
+		defer game.stateLog.Close()
 	}
 
-	// TODO: do something with or remove these
-	camPos := pixel.ZV
-	camZoom := 1.0
-
-	// The stage's origin 0,0 is at its center.
-	stageBounds := bounds.Moved(pixel.V(-bounds.W()/2, -bounds.H()/2))
-	stage := MakeStage(Stage{win: win, bounds: stageBounds, spritesheet: treesheet,
-		spritesheetImage: treesheetImage, frames: treeFrames})
-
-	game := makeGame(&stage)
+	// In co-op each player has half of the keyboard and a gamepad. More players need more gamepads.
+	for i := 0; i < maxCoopPlayers; i++ {
+		controllers := Controllers{makeGamepadController(win, pixelgl.Joystick1+pixelgl.Joystick(i))}
+		if i < len(coopKeyBindings) {
+			controllers = append(controllers, makeKeyboardController(win, coopKeyBindings[i]))
+		}
+		game.controllers = append(game.controllers, controllers)
+	}
+	game.attract = true
+	game.showTitle()
 
 	last := time.Now()
 
@@ -82,6 +126,26 @@ func run() {
 	}
 }
 
+// makeGameStage creates the Stage with the game's spritesheet. win may be nil for a headless Stage.
+func makeGameStage(win *pixelgl.Window) (Stage, error) {
+	treesheet, treesheetImage, err := loadPicture("trees.png")
+	if err != nil {
+		return Stage{}, err
+	}
+
+	var treeFrames []pixel.Rect
+	for x := treesheet.Bounds().Min.X; x < treesheet.Bounds().Max.X; x += 32 {
+		for y := treesheet.Bounds().Min.Y; y < treesheet.Bounds().Max.Y; y += 32 {
+			treeFrames = append(treeFrames, pixel.R(x, y, x+32, y+32))
+		}
+	}
+
+	// The stage's origin 0,0 is at its center.
+	stageBounds := screenBounds.Moved(pixel.V(-screenBounds.W()/2, -screenBounds.H()/2))
+	return MakeStage(Stage{win: win, bounds: stageBounds, spritesheet: treesheet,
+		spritesheetImage: treesheetImage, frames: treeFrames}), nil
+}
+
 func loadPicture(path string) (pixel.Picture, image.Image, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -95,6 +159,73 @@ func loadPicture(path string) (pixel.Picture, image.Image, error) {
 	return pixel.PictureDataFromImage(img), img, nil
 }
 
+// openStateLogFlag opens the -state-log file, if there is one.
+func openStateLogFlag() *StateLog {
+	if *stateLog == "" {
+		return nil
+	}
+	l, err := openStateLog(*stateLog, *stateEvery)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return l
+}
+
 func main() {
+	flag.Parse()
+
+	// Get fresh random numbers every run unless asked to repeat a run.
+	if *seed != 0 {
+		rand.Seed(*seed)
+	} else {
+		rand.Seed(time.Now().Unix())
+	}
+
+	if *diff {
+		if flag.NArg() != 2 {
+			log.Fatal("-diff needs two files to compare")
+		}
+		if err := runDiff(flag.Arg(0), flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *benchGames > 0 {
+		benchLog := openStateLogFlag()
+		err := runBenchmark(*benchGames, *benchSeconds, benchLog)
+		if benchLog != nil {
+			benchLog.Close()
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *envServer != "" {
+		config := defaultEnvConfig
+		config.observation = *envObserve
+		log.Fatal(serveEnv(*envServer, config))
+	}
+
+	conditions := NetConditions{latency: *netLatency, jitter: *netJitter, loss: *netLoss}
+	if *netServer != "" {
+		log.Fatal(serveNet(*netServer, int(math.Max(1, math.Min(maxCoopPlayers, float64(*netPlayers)))), conditions))
+	}
+	if *lockstep != "" {
+		// Every peer must simulate from the same seed.
+		lockstepSeed := *seed
+		if lockstepSeed == 0 {
+			lockstepSeed = 1
+		}
+		pixelgl.Run(func() { runLockstep(strings.Split(*lockstep, ","), *lockstepAs, lockstepSeed, conditions) })
+		return
+	}
+	if *netConnect != "" {
+		pixelgl.Run(func() { runNetClient(*netConnect, conditions) })
+		return
+	}
+
 	pixelgl.Run(run)
 }
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+	"golang.org/x/image/colornames"
+)
+
+// netInterpolationDelay is how far, in server updates, the client shows remote Actors behind the
+// newest snapshot, so there is usually a later snapshot to interpolate toward.
+const netInterpolationDelay = 2 * netSnapshotEvery
+
+// NetClient plays on a NetServer. The client's own ship is predicted: the server's latest state of
+// it has the inputs the server hasn't applied yet replayed on top, so it responds immediately.
+// Everything else is interpolated between snapshots, a little in the past.
+type NetClient struct {
+	conn       net.PacketConn
+	server     net.Addr
+	stage      *Stage
+	controller Controller
+	packets    chan netPacket
+
+	snapshots []*Snapshot      // The newest netHistory, oldest first.
+	received  time.Time        // When the newest snapshot arrived.
+	now       func() time.Time // The clock: time.Now, except in tests.
+
+	sequence   uint32     // Of the newest input.
+	inputs     []netInput // Sent but not yet applied by the server, oldest first.
+	inputClock float64    // Seconds since the newest input.
+
+	actors map[uint32]Actor // The stand-ins for the server's Actors, by id.
+	ship   *Ship            // The stand-in for the client's ship, if it has one.
+	hud    *TextActor
+	banner *TextActor
+}
+
+func makeNetClient(conn net.PacketConn, server net.Addr, stage *Stage, controller Controller) *NetClient {
+	c := &NetClient{conn: conn, server: server, stage: stage, controller: controller,
+		packets: make(chan netPacket, 256), actors: make(map[uint32]Actor), now: time.Now}
+
+	hud := MakeTextActor(pixel.V(0, stage.bounds.Max.Y-30), stage)
+	hud.scale = 2
+	hud.horizontalAlignment = "center"
+	c.hud = &hud
+	stage.AddActor(c.hud)
+
+	banner := MakeTextActor(pixel.V(0, 150), stage)
+	banner.scale = 3
+	banner.horizontalAlignment = "center"
+	c.banner = &banner
+	stage.AddActor(c.banner)
+
+	go readPackets(conn, c.packets)
+	return c
+}
+
+// runNetClient connects to the server at addr and plays in a window until it is closed.
+func runNetClient(addr string, conditions NetConditions) {
+	server, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	conn, err := listenNet(":0", conditions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	win, err := pixelgl.NewWindow(pixelgl.WindowConfig{Title: "Go Rocks!", Bounds: screenBounds, VSync: true})
+	if err != nil {
+		log.Fatal(err)
+	}
+	win.SetMatrix(pixel.IM.Moved(win.Bounds().Center()))
+	stage, err := makeGameStage(win)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := makeNetClient(conn, server, &stage, makeKeyboardController(win, defaultKeyBindings))
+	last := time.Now()
+	for !win.Closed() {
+		dt := time.Since(last).Seconds()
+		last = time.Now()
+
+		win.Clear(colornames.Black)
+		if err := client.update(dt); err != nil {
+			log.Fatal(err)
+		}
+		stage.Draw()
+		win.Update()
+	}
+}
+
+// update handles the packets received, sends input and brings the stand-in Actors up to date.
+func (c *NetClient) update(dt float64) error {
+	for receiving := true; receiving; {
+		select {
+		case packet := <-c.packets:
+			if packet.err != nil {
+				return packet.err
+			}
+			if packet.addr.String() == c.server.String() {
+				c.receive(packet.data)
+			}
+		default:
+			receiving = false
+		}
+	}
+
+	// Inputs are taken at the server's update rate, however fast the client's frames are.
+	c.inputClock += dt
+	for c.inputClock >= 1.0/netTickRate {
+		c.inputClock -= 1.0 / netTickRate
+		c.sendInput()
+	}
+
+	c.updateActors()
+	c.updateHUD()
+	return nil
+}
+
+// receive decodes a snapshot. Snapshots older than the newest, arriving out of order, are dropped.
+func (c *NetClient) receive(packet []byte) {
+	snapshot, err := decodeSnapshot(packet, c.snapshot)
+	if err != nil {
+		return
+	}
+	if newest := c.newest(); newest != nil && snapshot.tick <= newest.tick {
+		return
+	}
+
+	c.snapshots = append(c.snapshots, snapshot)
+	if len(c.snapshots) > netHistory {
+		c.snapshots = c.snapshots[1:]
+	}
+	c.received = c.now()
+
+	for len(c.inputs) > 0 && c.inputs[0].sequence <= snapshot.lastInput {
+		c.inputs = c.inputs[1:]
+	}
+}
+
+// snapshot returns the snapshot for the tick, or nil if it isn't kept.
+func (c *NetClient) snapshot(tick uint32) *Snapshot {
+	for _, snapshot := range c.snapshots {
+		if snapshot.tick == tick {
+			return snapshot
+		}
+	}
+	return nil
+}
+
+func (c *NetClient) newest() *Snapshot {
+	if len(c.snapshots) == 0 {
+		return nil
+	}
+	return c.snapshots[len(c.snapshots)-1]
+}
+
+// sendInput sends the newest Actions, along with the previous few in case packets are lost.
+func (c *NetClient) sendInput() {
+	c.sequence++
+	c.inputs = append(c.inputs, netInput{sequence: c.sequence, actions: c.controller.Actions(c.ship)})
+	if len(c.inputs) > netTickRate {
+		// The server isn't responding. Only the latest inputs matter when it does.
+		c.inputs = c.inputs[1:]
+	}
+
+	ack := uint32(0)
+	if newest := c.newest(); newest != nil {
+		ack = newest.tick
+	}
+	recent := c.inputs
+	if len(recent) > netInputRedundancy {
+		recent = recent[len(recent)-netInputRedundancy:]
+	}
+	c.conn.WriteTo(encodeInputs(ack, recent), c.server)
+}
+
+// updateActors shows the client's ship where prediction puts it and everything else interpolated
+// netInterpolationDelay updates behind the newest snapshot.
+func (c *NetClient) updateActors() {
+	newest := c.newest()
+	if newest == nil {
+		return
+	}
+
+	renderTick := float64(newest.tick) + c.now().Sub(c.received).Seconds()*netTickRate - netInterpolationDelay
+	from, to := newest, newest
+	for i := len(c.snapshots) - 1; i >= 0; i-- {
+		from = c.snapshots[i]
+		if float64(from.tick) <= renderTick {
+			break
+		}
+		to = from
+	}
+	t := 0.0
+	if to.tick > from.tick {
+		t = math.Max(0, math.Min(1, (renderTick-float64(from.tick))/float64(to.tick-from.tick)))
+	}
+
+	shown := make(map[uint32]bool)
+	c.ship = nil
+	for i := range newest.entities {
+		state := &newest.entities[i]
+		if netKinds[state.kind].kind == "ship" && int(state.variant) == newest.player {
+			if actor := c.show(state); actor != nil {
+				shown[state.id] = true
+				c.ship = actor.(*Ship)
+				c.predict(c.ship, state)
+			}
+		}
+	}
+	for i := range from.entities {
+		state := from.entities[i]
+		if shown[state.id] {
+			continue
+		}
+		if next := to.entity(state.id); next != nil {
+			state = interpolateEntity(state, *next, t, c.stage.bounds)
+		}
+		if c.show(&state) != nil {
+			shown[state.id] = true
+		}
+	}
+
+	for id, actor := range c.actors {
+		if !shown[id] {
+			c.stage.RemoveActor(actor)
+			delete(c.actors, id)
+		}
+	}
+}
+
+// show updates the stand-in for an entity, making it if need be. It returns nil if the entity
+// can't be shown.
+func (c *NetClient) show(state *EntityState) Actor {
+	actor, ok := c.actors[state.id]
+	if !ok {
+		if actor = netKinds[state.kind].make(c.stage, state); actor == nil {
+			return nil
+		}
+		c.actors[state.id] = actor
+		c.stage.AddActor(actor)
+	}
+	applyEntityState(actor, state)
+	return actor
+}
+
+// predict replays the inputs the server hasn't applied yet on the ship's latest server state.
+// Only flying is predicted. Collisions, hyperspace and the shield are left to the server.
+func (c *NetClient) predict(ship *Ship, state *EntityState) {
+	if ship.hyperspaceTimer > 0 {
+		return
+	}
+	dt := 1.0 / netTickRate
+	for _, input := range c.inputs {
+		ship.fly(input.actions, dt)
+		ship.WrapAroundActor.Update(dt)
+	}
+}
+
+// interpolateEntity returns the state t (0..1) of the way from one snapshot's state to the next's,
+// taking the shortest way around the screen and round the circle.
+func interpolateEntity(from EntityState, to EntityState, t float64, bounds pixel.Rect) EntityState {
+	state := from
+	state.position = from.position.Add(wrapDelta(to.position.Sub(from.position), bounds).Scaled(t))
+	wrapAroundVec(&state.position, &bounds)
+	state.velocity = pixel.Lerp(from.velocity, to.velocity, t)
+	state.rotation = from.rotation + math.Remainder(to.rotation-from.rotation, 2*math.Pi)*t
+	if t >= 0.5 {
+		state.flags = to.flags
+	}
+	return state
+}
+
+// updateHUD shows the players' scores and lives, or who the server is waiting for.
+func (c *NetClient) updateHUD() {
+	newest := c.newest()
+	if newest == nil {
+		c.hud.SetText("")
+		c.banner.SetText(fmt.Sprintf("CONNECTING TO %v", c.server))
+		return
+	}
+
+	var scores []string
+	joined := 0
+	for i, player := range newest.players {
+		you := ""
+		if i+1 == newest.player {
+			you = "*"
+		}
+		scores = append(scores, fmt.Sprintf("%vP%v %v SHIPS %v", you, i+1, player.score, player.lives))
+		if player.connected {
+			joined++
+		}
+	}
+	c.hud.SetText(strings.Join(scores, "   "))
+
+	switch {
+	case !newest.started:
+		c.banner.SetText(fmt.Sprintf("PLAYER %v\nWAITING FOR PLAYERS %v/%v", newest.player, joined, len(newest.players)))
+	case c.now().Sub(c.received) > time.Second:
+		c.banner.SetText("CONNECTION LOST")
+	default:
+		c.banner.SetText("")
+	}
+}
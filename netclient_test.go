@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+// memoryConn is a PacketConn that keeps the packets written to it for the test to deliver, or lose.
+// Nothing arrives to be read.
+type memoryConn struct {
+	net.PacketConn // Only the methods below are implemented.
+	addr           net.Addr
+	sent           []netPacket // With the addresses they were sent to.
+	closed         chan struct{}
+}
+
+func makeMemoryConn(port int) *memoryConn {
+	return &memoryConn{addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, closed: make(chan struct{})}
+}
+
+func (c *memoryConn) WriteTo(packet []byte, addr net.Addr) (int, error) {
+	c.sent = append(c.sent, netPacket{data: append([]byte(nil), packet...), addr: addr})
+	return len(packet), nil
+}
+
+func (c *memoryConn) ReadFrom(buf []byte) (int, net.Addr, error) {
+	<-c.closed
+	return 0, nil, errors.New("closed")
+}
+
+func (c *memoryConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// take returns the packets written since last time.
+func (c *memoryConn) take() []netPacket {
+	sent := c.sent
+	c.sent = nil
+	return sent
+}
+
+func TestNetClientLoopback(t *testing.T) {
+	rand.Seed(1)
+	loss := rand.New(rand.NewSource(1))
+	const lossRate = 0.2
+	serverConn, clientConn := makeMemoryConn(1000), makeMemoryConn(2000)
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server, err := makeNetServer(serverConn, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stage, err := makeGameStage(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := makeNetClient(clientConn, serverConn.addr, &stage, &actionsController{actions: TurnLeft})
+	clock := time.Unix(0, 0)
+	client.now = func() time.Time { return clock }
+
+	// Where the server's rocks were after each update, by id.
+	rocks := make(map[uint32]map[uint32]pixel.Vec)
+	compared, flown := 0, 0
+	for tick := 0; tick < 10*netTickRate; tick++ {
+		for _, packet := range clientConn.take() {
+			if loss.Float64() >= lossRate {
+				server.receive(netPacket{data: packet.data, addr: clientConn.addr})
+			}
+		}
+		server.update()
+		rocks[server.tick] = make(map[uint32]pixel.Vec)
+		for _, rock := range server.stage.FindActorsByKind("rock") {
+			rocks[server.tick][uint32(server.stage.ActorID(rock))] = rock.Position()
+		}
+		for _, packet := range serverConn.take() {
+			if loss.Float64() >= lossRate {
+				client.packets <- netPacket{data: packet.data, addr: serverConn.addr}
+			}
+		}
+
+		clock = clock.Add(time.Second / netTickRate)
+		if err := client.update(1.0 / netTickRate); err != nil {
+			t.Fatal(err)
+		}
+		if client.ship != nil {
+			flown++
+		}
+
+		// With a snapshot just in, the stand-ins are shown where the server had them
+		// netInterpolationDelay updates before it.
+		newest := client.newest()
+		if newest == nil || !client.received.Equal(clock) {
+			continue
+		}
+		past := rocks[newest.tick-netInterpolationDelay]
+		for id, actor := range client.actors {
+			want, ok := past[id]
+			if actor.Kind() != "rock" || !ok {
+				continue
+			}
+			compared++
+			if got := actor.Position(); wrapDelta(got.Sub(want), stage.bounds).Len() > 0.5 {
+				t.Errorf("tick %v: rock %v is at %v on the client, was at %v on the server", newest.tick, id, got, want)
+			}
+		}
+	}
+
+	if !server.started || flown < netTickRate || server.peers[0].nextInput < 5*netTickRate {
+		t.Fatalf("not flying: started %v, flew for %v updates, %v inputs applied", server.started, flown,
+			server.peers[0].nextInput)
+	}
+	if compared < 100 {
+		t.Errorf("only %v rock positions compared", compared)
+	}
+	// The server turned the ship as the client asked.
+	ship := server.game.players[0].ship
+	if ship == nil || ship.rotation == 0 {
+		t.Errorf("the server's ship didn't turn")
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/text"
+)
+
+// Networked play has a server run the Game headless, as the authority on everything, while each
+// client flies one player's ships in co-op. Clients send the server their Actions and the server
+// sends back snapshots of the Actors. A snapshot only carries what changed since the latest one
+// the client acknowledged receiving, its baseline.
+//
+// Packets are small binary messages, big endian:
+//
+//	input:    type, ack tick u32, count u8, then count x (sequence u32, actions u8), oldest first
+//	snapshot: type, tick u32, baseline tick u32 (0 for none), last input u32, player u8, started u8,
+//	          players u8, then per player (connected u8, score i32, lives u8, level u16),
+//	          removed u16, then removed x id u32, changed u16, then changed x entity
+//	entity:   id u32, fields u8, then if fieldNew kind u8, variant u8 and the kind's static data,
+//	          then the fields present: position, velocity (2 x f32), rotation (f32), flags (u8)
+//
+// Inputs are repeated in several packets, and missing snapshots only delay the next baseline, so
+// occasional packet loss is harmless. Snapshots of a full Stage may exceed the usual MTU and be
+// fragmented, which is fine over loopback and a LAN.
+const (
+	netTickRate        = 60 // Server updates per second. Clients send inputs at the same rate.
+	netSnapshotEvery   = 3  // Server updates between snapshots.
+	netHistory         = 32 // Snapshots kept for baselines and interpolation.
+	netInputRedundancy = 8  // Inputs in each input packet.
+	netMaxPacket       = 65507
+)
+
+const (
+	inputPacket uint8 = iota + 1
+	snapshotPacket
+)
+
+// The fields of an EntityState present in a snapshot.
+const (
+	fieldPosition uint8 = 1 << iota
+	fieldVelocity
+	fieldRotation
+	fieldFlags
+	fieldNew // Not in the baseline, so kind, variant and static data follow.
+
+	allFields = fieldPosition | fieldVelocity | fieldRotation | fieldFlags
+)
+
+// EntityState flags.
+const (
+	entityHidden   uint8 = 1 << iota // In hyperspace, or blinked off.
+	entityShielded                   // The Ship's shield is up.
+)
+
+// EntityState is the replicated state of an Actor. Values are rounded to float32, as sent, so the
+// server's copy of a baseline matches the client's.
+type EntityState struct {
+	id       uint32 // The Actor's ID on the server's Stage.
+	kind     uint8  // Index into netKinds.
+	variant  uint8  // Rock generation, Ship player number or powerUpTypes index.
+	flags    uint8
+	position pixel.Vec
+	velocity pixel.Vec
+	rotation float64
+
+	// Static data, only sent when the entity is new.
+	outline Polygon   // Rock.
+	end     pixel.Vec // LaserBeam.
+}
+
+// changedFields returns the fields that differ from the baseline's state.
+func (e *EntityState) changedFields(baseline *EntityState) uint8 {
+	var fields uint8
+	if e.position != baseline.position {
+		fields |= fieldPosition
+	}
+	if e.velocity != baseline.velocity {
+		fields |= fieldVelocity
+	}
+	if e.rotation != baseline.rotation {
+		fields |= fieldRotation
+	}
+	if e.flags != baseline.flags {
+		fields |= fieldFlags
+	}
+	return fields
+}
+
+// PlayerState is the replicated state of a Player.
+type PlayerState struct {
+	connected bool
+	score     int
+	lives     int
+	level     int
+}
+
+// Snapshot is the state of the server's Game after an update.
+type Snapshot struct {
+	tick      uint32
+	lastInput uint32 // Sequence number of the last of the receiving client's inputs applied.
+	player    int    // The receiving client's player number.
+	started   bool   // Whether the game has started. Until then the server waits for players.
+	players   []PlayerState
+	entities  []EntityState // Sorted by id.
+}
+
+// entity returns the state of the entity with the given id, or nil.
+func (s *Snapshot) entity(id uint32) *EntityState {
+	i := sort.Search(len(s.entities), func(i int) bool { return s.entities[i].id >= id })
+	if i < len(s.entities) && s.entities[i].id == id {
+		return &s.entities[i]
+	}
+	return nil
+}
+
+// netKind describes how a kind of Actor is replicated: what the server captures besides position,
+// velocity and rotation, and how a client makes the stand-in Actor it draws. Stand-ins are never
+// updated by the client's Stage, only drawn. To replicate another kind of Actor, add it here.
+type netKind struct {
+	kind    string
+	capture func(actor Actor, state *EntityState) // Optional.
+	make    func(stage *Stage, state *EntityState) Actor
+	apply   func(actor Actor, state *EntityState) // Optional. Sets kind-specific fields from the state.
+}
+
+var netKinds = []netKind{
+	{
+		kind: "rock",
+		capture: func(actor Actor, state *EntityState) {
+			rock := actor.(*Rock)
+			state.variant = uint8(rock.generation)
+			state.outline = rock.shape.outline
+		},
+		make: func(stage *Stage, state *EntityState) Actor {
+			generation := int(state.variant)
+			if generation < 1 || generation > len(rockScales) || len(state.outline) < 3 {
+				return nil
+			}
+			rock := Rock{BaseActor: MakeBaseActor(stage, "rock"), generation: generation,
+				shape: makeRockShape(0, append(Polygon(nil), state.outline...)), imd: imdraw.New(nil)}
+			rock.scale = rockScales[generation-1]
+			return &rock
+		},
+	},
+	{
+		kind: "ship",
+		capture: func(actor Actor, state *EntityState) {
+			ship := actor.(*Ship)
+			if ship.player != nil {
+				state.variant = uint8(ship.player.number)
+			}
+			if ship.hyperspaceTimer > 0 {
+				state.flags |= entityHidden
+			}
+			if ship.shielded {
+				state.flags |= entityShielded
+			}
+		},
+		make: func(stage *Stage, state *EntityState) Actor {
+			ship := Ship{WrapAroundActor: makeWrapAroundActor(shipFrame, stage, "ship"),
+				flight: defaultFlightModel, imd: imdraw.New(nil)}
+			ship.scale = 1.5
+			return &ship
+		},
+		apply: func(actor Actor, state *EntityState) {
+			ship := actor.(*Ship)
+			ship.hyperspaceTimer = 0
+			if state.flags&entityHidden != 0 {
+				ship.hyperspaceTimer = 1
+			}
+			ship.shielded = state.flags&entityShielded != 0
+		},
+	},
+	{
+		kind: "shot",
+		make: func(stage *Stage, state *EntityState) Actor {
+			shot := Shot{WrapAroundActor: makeWrapAroundActor(6, stage, "shot")}
+			shot.scale = 0.4
+			return &shot
+		},
+	},
+	{
+		kind: "missile",
+		make: func(stage *Stage, state *EntityState) Actor {
+			missile := Missile{WrapAroundActor: makeWrapAroundActor(6, stage, "missile")}
+			missile.scale = 0.7
+			return &missile
+		},
+	},
+	{
+		kind: "beam",
+		capture: func(actor Actor, state *EntityState) {
+			state.end = actor.(*LaserBeam).end
+		},
+		make: func(stage *Stage, state *EntityState) Actor {
+			return &LaserBeam{BaseActor: MakeBaseActor(stage, "beam"), end: state.end, imd: imdraw.New(nil)}
+		},
+	},
+	{
+		kind: "powerUp",
+		capture: func(actor Actor, state *EntityState) {
+			powerUp := actor.(*PowerUp)
+			for i := range powerUpTypes {
+				if powerUp.powerUpType == &powerUpTypes[i] {
+					state.variant = uint8(i)
+				}
+			}
+			if powerUp.lifetime < 2 && int(powerUp.lifetime*8)%2 == 1 {
+				state.flags |= entityHidden
+			}
+		},
+		make: func(stage *Stage, state *EntityState) Actor {
+			if int(state.variant) >= len(powerUpTypes) {
+				return nil
+			}
+			powerUpType := &powerUpTypes[state.variant]
+			powerUp := PowerUp{BaseActor: MakeBaseActor(stage, "powerUp"), powerUpType: powerUpType, imd: imdraw.New(nil)}
+			powerUp.txt = text.New(pixel.ZV, stage.textAtlas)
+			powerUp.txt.Color = powerUpType.color
+			fmt.Fprint(powerUp.txt, powerUpType.label)
+			return &powerUp
+		},
+		apply: func(actor Actor, state *EntityState) {
+			// PowerUp.Draw blinks according to the lifetime left.
+			powerUp := actor.(*PowerUp)
+			powerUp.lifetime = 10
+			if state.flags&entityHidden != 0 {
+				powerUp.lifetime = 0.15
+			}
+		},
+	},
+}
+
+// netKindIndex maps Actor kinds to their index in netKinds.
+var netKindIndex = func() map[string]uint8 {
+	index := make(map[string]uint8)
+	for i, kind := range netKinds {
+		index[kind.kind] = uint8(i)
+	}
+	return index
+}()
+
+// applyEntityState sets a stand-in Actor from the state.
+func applyEntityState(actor Actor, state *EntityState) {
+	base := actor.(interface{ baseActor() *BaseActor }).baseActor()
+	base.position = state.position
+	base.velocity = state.velocity
+	base.rotation = state.rotation
+	if apply := netKinds[state.kind].apply; apply != nil {
+		apply(actor, state)
+	}
+}
+
+// roundFloat rounds to the precision sent over the network.
+func roundFloat(f float64) float64 {
+	return float64(float32(f))
+}
+
+func roundVec(v pixel.Vec) pixel.Vec {
+	return pixel.V(roundFloat(v.X), roundFloat(v.Y))
+}
+
+// captureEntities returns the state of the replicated Actors on the Stage.
+func captureEntities(stage *Stage) []EntityState {
+	var entities []EntityState
+	for _, actor := range stage.actors {
+		if actor == nil {
+			continue
+		}
+		kind, ok := netKindIndex[actor.Kind()]
+		if !ok {
+			continue
+		}
+		state := EntityState{id: uint32(stage.ActorID(actor)), kind: kind, position: roundVec(actor.Position()),
+			velocity: roundVec(actor.Velocity()), rotation: roundFloat(math.Remainder(actor.Rotation(), 2*math.Pi))}
+		if capture := netKinds[kind].capture; capture != nil {
+			capture(actor, &state)
+		}
+		outline := make(Polygon, len(state.outline))
+		for i, v := range state.outline {
+			outline[i] = roundVec(v)
+		}
+		state.outline = outline
+		state.end = roundVec(state.end)
+		entities = append(entities, state)
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i].id < entities[j].id })
+	return entities
+}
+
+var errBadPacket = errors.New("malformed packet")
+
+// packetWriter appends values to a packet.
+type packetWriter struct {
+	buf []byte
+}
+
+func (w *packetWriter) u8(v uint8) {
+	w.buf = append(w.buf, v)
+}
+
+func (w *packetWriter) u16(v uint16) {
+	w.buf = append(w.buf, byte(v>>8), byte(v))
+}
+
+func (w *packetWriter) u32(v uint32) {
+	w.buf = append(w.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (w *packetWriter) f32(v float64) {
+	w.u32(math.Float32bits(float32(v)))
+}
+
+func (w *packetWriter) vec(v pixel.Vec) {
+	w.f32(v.X)
+	w.f32(v.Y)
+}
+
+// packetReader reads values from a packet. Reading past the end sets err and returns zeros.
+type packetReader struct {
+	buf []byte
+	err error
+}
+
+func (r *packetReader) take(n int) []byte {
+	if r.err != nil || len(r.buf) < n {
+		r.err = errBadPacket
+		return make([]byte, n)
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *packetReader) u8() uint8 {
+	return r.take(1)[0]
+}
+
+func (r *packetReader) u16() uint16 {
+	b := r.take(2)
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+func (r *packetReader) u32() uint32 {
+	b := r.take(4)
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func (r *packetReader) f32() float64 {
+	return float64(math.Float32frombits(r.u32()))
+}
+
+func (r *packetReader) vec() pixel.Vec {
+	return pixel.V(r.f32(), r.f32())
+}
+
+// netInput is the Actions of one client frame.
+type netInput struct {
+	sequence uint32
+	actions  Actions
+}
+
+// encodeInputs makes an input packet acknowledging the snapshot with tick ack.
+func encodeInputs(ack uint32, inputs []netInput) []byte {
+	w := packetWriter{}
+	w.u8(inputPacket)
+	w.u32(ack)
+	w.u8(uint8(len(inputs)))
+	for _, input := range inputs {
+		w.u32(input.sequence)
+		w.u8(uint8(input.actions))
+	}
+	return w.buf
+}
+
+func decodeInputs(packet []byte) (ack uint32, inputs []netInput, err error) {
+	r := packetReader{buf: packet}
+	if r.u8() != inputPacket {
+		return 0, nil, errBadPacket
+	}
+	ack = r.u32()
+	count := int(r.u8())
+	for i := 0; i < count && r.err == nil; i++ {
+		inputs = append(inputs, netInput{sequence: r.u32(), actions: Actions(r.u8())})
+	}
+	return ack, inputs, r.err
+}
+
+// encodeSnapshot makes a snapshot packet with only the differences from baseline, or everything if
+// baseline is nil.
+func encodeSnapshot(snapshot *Snapshot, baseline *Snapshot) []byte {
+	w := packetWriter{}
+	w.u8(snapshotPacket)
+	w.u32(snapshot.tick)
+	if baseline != nil {
+		w.u32(baseline.tick)
+	} else {
+		w.u32(0)
+		baseline = &Snapshot{}
+	}
+	w.u32(snapshot.lastInput)
+	w.u8(uint8(snapshot.player))
+	started := uint8(0)
+	if snapshot.started {
+		started = 1
+	}
+	w.u8(started)
+	w.u8(uint8(len(snapshot.players)))
+	for _, player := range snapshot.players {
+		connected := uint8(0)
+		if player.connected {
+			connected = 1
+		}
+		w.u8(connected)
+		w.u32(uint32(int32(player.score)))
+		w.u8(uint8(player.lives))
+		w.u16(uint16(player.level))
+	}
+
+	var removed []uint32
+	for _, entity := range baseline.entities {
+		if snapshot.entity(entity.id) == nil {
+			removed = append(removed, entity.id)
+		}
+	}
+	w.u16(uint16(len(removed)))
+	for _, id := range removed {
+		w.u32(id)
+	}
+
+	changed := packetWriter{}
+	count := 0
+	for i := range snapshot.entities {
+		entity := &snapshot.entities[i]
+		fields := allFields | fieldNew
+		if old := baseline.entity(entity.id); old != nil {
+			fields = entity.changedFields(old)
+		}
+		if fields == 0 {
+			continue
+		}
+		count++
+		changed.u32(entity.id)
+		changed.u8(fields)
+		if fields&fieldNew != 0 {
+			changed.u8(entity.kind)
+			changed.u8(entity.variant)
+			switch netKinds[entity.kind].kind {
+			case "rock":
+				changed.u8(uint8(len(entity.outline)))
+				for _, v := range entity.outline {
+					changed.vec(v)
+				}
+			case "beam":
+				changed.vec(entity.end)
+			}
+		}
+		if fields&fieldPosition != 0 {
+			changed.vec(entity.position)
+		}
+		if fields&fieldVelocity != 0 {
+			changed.vec(entity.velocity)
+		}
+		if fields&fieldRotation != 0 {
+			changed.f32(entity.rotation)
+		}
+		if fields&fieldFlags != 0 {
+			changed.u8(entity.flags)
+		}
+	}
+	w.u16(uint16(count))
+	w.buf = append(w.buf, changed.buf...)
+	return w.buf
+}
+
+// decodeSnapshot reads a snapshot packet. baseline looks up the snapshot it was encoded against;
+// if that isn't available the packet can't be decoded.
+func decodeSnapshot(packet []byte, baseline func(tick uint32) *Snapshot) (*Snapshot, error) {
+	r := packetReader{buf: packet}
+	if r.u8() != snapshotPacket {
+		return nil, errBadPacket
+	}
+	snapshot := Snapshot{tick: r.u32()}
+	base := &Snapshot{}
+	if tick := r.u32(); tick != 0 {
+		if base = baseline(tick); base == nil {
+			return nil, errors.New("snapshot baseline not available")
+		}
+	}
+	snapshot.lastInput = r.u32()
+	snapshot.player = int(r.u8())
+	snapshot.started = r.u8() != 0
+	snapshot.players = make([]PlayerState, r.u8())
+	for i := range snapshot.players {
+		snapshot.players[i] = PlayerState{connected: r.u8() != 0, score: int(int32(r.u32())),
+			lives: int(r.u8()), level: int(r.u16())}
+	}
+
+	removed := make(map[uint32]bool)
+	for i := int(r.u16()); i > 0 && r.err == nil; i-- {
+		removed[r.u32()] = true
+	}
+	entities := make(map[uint32]EntityState)
+	for _, entity := range base.entities {
+		if !removed[entity.id] {
+			entities[entity.id] = entity
+		}
+	}
+
+	for i := int(r.u16()); i > 0 && r.err == nil; i-- {
+		id := r.u32()
+		fields := r.u8()
+		entity, ok := entities[id]
+		if fields&fieldNew != 0 {
+			entity = EntityState{id: id, kind: r.u8(), variant: r.u8()}
+			if int(entity.kind) >= len(netKinds) {
+				return nil, errBadPacket
+			}
+			switch netKinds[entity.kind].kind {
+			case "rock":
+				entity.outline = make(Polygon, r.u8())
+				for j := range entity.outline {
+					entity.outline[j] = r.vec()
+				}
+			case "beam":
+				entity.end = r.vec()
+			}
+		} else if !ok {
+			return nil, errBadPacket
+		}
+		if fields&fieldPosition != 0 {
+			entity.position = r.vec()
+		}
+		if fields&fieldVelocity != 0 {
+			entity.velocity = r.vec()
+		}
+		if fields&fieldRotation != 0 {
+			entity.rotation = r.f32()
+		}
+		if fields&fieldFlags != 0 {
+			entity.flags = r.u8()
+		}
+		entities[id] = entity
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	for _, entity := range entities {
+		snapshot.entities = append(snapshot.entities, entity)
+	}
+	sort.Slice(snapshot.entities, func(i, j int) bool { return snapshot.entities[i].id < snapshot.entities[j].id })
+	return &snapshot, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestSnapshotBaseline(t *testing.T) {
+	rock, ship, shot := netKindIndex["rock"], netKindIndex["ship"], netKindIndex["shot"]
+	players := []PlayerState{{connected: true, score: 120, lives: 3, level: 2}}
+	baseline := &Snapshot{tick: 30, lastInput: 7, player: 1, started: true, players: players, entities: []EntityState{
+		{id: 1, kind: ship, variant: 1, position: pixel.V(10, 20), rotation: 0.5},
+		{id: 2, kind: rock, variant: 1, position: pixel.V(-100, 50), velocity: pixel.V(1, -1),
+			outline: Polygon{pixel.V(0, 10), pixel.V(10, -10), pixel.V(-10, -10)}},
+		{id: 3, kind: shot, position: pixel.V(30, 30), velocity: pixel.V(5, 0)},
+	}}
+
+	full := encodeSnapshot(baseline, nil)
+	noBaseline := func(tick uint32) *Snapshot { return nil }
+	decoded, err := decodeSnapshot(full, noBaseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, baseline) {
+		t.Fatalf("got %+v, want %+v", decoded, baseline)
+	}
+
+	// The ship turns and flashes its shield, the shot is gone and a new one fired.
+	next := &Snapshot{tick: 33, lastInput: 9, player: 1, started: true, players: players, entities: []EntityState{
+		{id: 1, kind: ship, variant: 1, flags: entityShielded, position: pixel.V(10, 20), rotation: 0.75},
+		baseline.entities[1],
+		{id: 4, kind: shot, position: pixel.V(12, 24), velocity: pixel.V(0, 5)},
+	}}
+	delta := encodeSnapshot(next, baseline)
+	if len(delta) >= len(encodeSnapshot(next, nil)) {
+		t.Errorf("a delta of %v bytes isn't smaller than the whole snapshot", len(delta))
+	}
+	lookup := func(tick uint32) *Snapshot {
+		if tick == decoded.tick {
+			return decoded
+		}
+		return nil
+	}
+	decodedNext, err := decodeSnapshot(delta, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decodedNext, next) {
+		t.Errorf("got %+v, want %+v", decodedNext, next)
+	}
+
+	if _, err := decodeSnapshot(delta, noBaseline); err == nil {
+		t.Error("decoded a delta without its baseline")
+	}
+	if _, err := decodeSnapshot(delta[:len(delta)-1], lookup); err == nil {
+		t.Error("decoded a truncated snapshot")
+	}
+}
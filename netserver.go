@@ -0,0 +1,244 @@
+package main
+
+import (
+	"log"
+	"net"
+	"time"
+)
+
+// netTimeout is how long the server waits to hear from a client before giving its place away.
+const netTimeout = 5 * time.Second
+
+// netMaxQueuedInputs is how far a client's inputs may get ahead of the server before the oldest
+// are dropped to catch up.
+const netMaxQueuedInputs = 2 * netInputRedundancy
+
+// NetServer runs the authoritative Game for networked clients, a co-op game with a player per
+// client. The game starts once every player has joined and is restarted when it's over.
+type NetServer struct {
+	conn    net.PacketConn
+	stage   Stage
+	audio   Audio
+	game    *Game
+	peers   []*netPeer // Indexed by player number - 1.
+	started bool
+	tick    uint32
+	history [netHistory]*Snapshot // Recent snapshots, by tick / netSnapshotEvery.
+}
+
+// netPeer is the server's side of a client, and the Controller of the client player's ships.
+type netPeer struct {
+	addr      net.Addr // nil while no client has the player.
+	lastHeard time.Time
+	inputs    map[uint32]Actions // Received but not yet applied, by sequence number.
+	nextInput uint32             // Sequence number of the next input to apply.
+	latest    uint32             // Sequence number of the oldest input in the latest packet.
+	starved   int                // Updates in a row with no input queued.
+	actions   Actions            // The Actions applied this update.
+	acked     uint32             // Tick of the newest snapshot the client has received.
+}
+
+// Actions returns the client's input for this update. Ships without a client don't do anything.
+func (p *netPeer) Actions(ship *Ship) Actions {
+	if p.addr == nil {
+		return 0
+	}
+	return p.actions
+}
+
+func makeNetServer(conn net.PacketConn, players int) (*NetServer, error) {
+	stage, err := makeGameStage(nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &NetServer{conn: conn, stage: stage, audio: MakeAudio(nullAudioBackend{})}
+	s.game = makeGame(&s.stage, &s.audio, nil)
+	s.game.friendlyFire = *friendlyFire
+	s.game.sharedLives = *sharedLives
+	for i := 0; i < players; i++ {
+		peer := &netPeer{}
+		s.peers = append(s.peers, peer)
+		s.game.controllers = append(s.game.controllers, peer)
+	}
+	return s, nil
+}
+
+// serveNet runs a NetServer for the given number of players on addr until there's a network error.
+func serveNet(addr string, players int, conditions NetConditions) error {
+	conn, err := listenNet(addr, conditions)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	server, err := makeNetServer(conn, players)
+	if err != nil {
+		return err
+	}
+	log.Printf("Game server for %v players listening on %v", players, conn.LocalAddr())
+
+	packets := make(chan netPacket, 256)
+	go readPackets(conn, packets)
+	ticker := time.NewTicker(time.Second / netTickRate)
+	defer ticker.Stop()
+	for {
+		select {
+		case packet := <-packets:
+			if packet.err != nil {
+				return packet.err
+			}
+			server.receive(packet)
+		case <-ticker.C:
+			server.update()
+		}
+	}
+}
+
+// receive handles an input packet. A client is given a free player when first heard from.
+func (s *NetServer) receive(packet netPacket) {
+	ack, inputs, err := decodeInputs(packet.data)
+	if err != nil {
+		return
+	}
+
+	peer := s.peer(packet.addr)
+	if peer == nil {
+		for i, free := range s.peers {
+			if free.addr == nil {
+				peer = free
+				*peer = netPeer{addr: packet.addr, inputs: make(map[uint32]Actions)}
+				if len(inputs) > 0 {
+					peer.nextInput = inputs[0].sequence
+				}
+				log.Printf("Player %v joined from %v", i+1, packet.addr)
+				break
+			}
+		}
+		if peer == nil {
+			return
+		}
+	}
+
+	peer.lastHeard = time.Now()
+	if ack > peer.acked {
+		peer.acked = ack
+	}
+	// Inputs too far ahead, e.g. from a buggy client, aren't queued. If the client really is that far
+	// ahead nextActions catches up with it.
+	if len(inputs) > 0 {
+		peer.latest = inputs[0].sequence
+	}
+	for _, input := range inputs {
+		if input.sequence >= peer.nextInput && input.sequence-peer.nextInput <= netMaxQueuedInputs {
+			peer.inputs[input.sequence] = input.actions
+		}
+	}
+}
+
+// peer returns the peer of the client at addr, or nil.
+func (s *NetServer) peer(addr net.Addr) *netPeer {
+	for _, peer := range s.peers {
+		if peer.addr != nil && peer.addr.String() == addr.String() {
+			return peer
+		}
+	}
+	return nil
+}
+
+// update applies each client's next input, updates the Game and, every netSnapshotEvery updates,
+// sends the clients a snapshot.
+func (s *NetServer) update() {
+	joined := 0
+	for i, peer := range s.peers {
+		if peer.addr != nil && time.Since(peer.lastHeard) > netTimeout {
+			log.Printf("Player %v timed out", i+1)
+			peer.addr = nil
+		}
+		if peer.addr != nil {
+			joined++
+			peer.nextActions()
+		}
+	}
+
+	switch {
+	case !s.started && joined == len(s.peers):
+		s.started = true
+		s.game.startGame(PlayingState, len(s.peers), true)
+	case s.started && joined == 0:
+		s.started = false
+	}
+	if s.started {
+		s.game.update(1.0 / netTickRate)
+	}
+
+	s.tick++
+	if s.tick%netSnapshotEvery == 0 {
+		s.sendSnapshots()
+	}
+}
+
+// nextActions applies the next input in sequence. If it was lost it's skipped, rather than holding
+// up the game.
+func (p *netPeer) nextActions() {
+	if len(p.inputs) == 0 {
+		// After a long outage the client's inputs may all be too far ahead to be queued. Catch up
+		// with the latest packet, rather than the newest input, which could be bogus.
+		p.starved++
+		if p.starved > netMaxQueuedInputs {
+			p.nextInput = p.latest
+			p.starved = 0
+		}
+		return
+	}
+	p.starved = 0
+	for len(p.inputs) > netMaxQueuedInputs {
+		delete(p.inputs, p.oldestInput())
+	}
+	p.nextInput = p.oldestInput()
+	p.actions = p.inputs[p.nextInput]
+	delete(p.inputs, p.nextInput)
+	p.nextInput++
+}
+
+// oldestInput returns the smallest sequence number queued.
+func (p *netPeer) oldestInput() uint32 {
+	oldest, first := uint32(0), true
+	for sequence := range p.inputs {
+		if first || sequence < oldest {
+			oldest, first = sequence, false
+		}
+	}
+	return oldest
+}
+
+// sendSnapshots captures the Game and sends each client what changed since their baseline.
+func (s *NetServer) sendSnapshots() {
+	snapshot := Snapshot{tick: s.tick, started: s.started}
+	for i, peer := range s.peers {
+		player := PlayerState{connected: peer.addr != nil}
+		if s.started && i < len(s.game.players) {
+			p := s.game.players[i]
+			player.score, player.lives, player.level = p.score, p.lives, p.level
+		}
+		snapshot.players = append(snapshot.players, player)
+	}
+	if s.started {
+		snapshot.entities = captureEntities(&s.stage)
+	}
+	s.history[s.tick/netSnapshotEvery%netHistory] = &snapshot
+
+	for i, peer := range s.peers {
+		if peer.addr == nil {
+			continue
+		}
+		var baseline *Snapshot
+		if past := s.history[peer.acked/netSnapshotEvery%netHistory]; past != nil && past.tick == peer.acked {
+			baseline = past
+		}
+		client := snapshot
+		client.lastInput = peer.nextInput - 1
+		client.player = i + 1
+		if _, err := s.conn.WriteTo(encodeSnapshot(&client, baseline), peer.addr); err != nil {
+			log.Printf("Player %v: %v", i+1, err)
+		}
+	}
+}
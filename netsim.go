@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// NetConditions simulates a poor network on the packets a side sends, for testing networked play
+// over loopback. Give both the server and the client conditions to affect both directions.
+type NetConditions struct {
+	latency time.Duration // Added to every packet.
+	jitter  time.Duration // Up to this much more at random, so packets can arrive out of order.
+	loss    float64       // Fraction (0..1) of packets dropped.
+}
+
+// simulatedConn delays and drops the packets written to a PacketConn according to its NetConditions.
+type simulatedConn struct {
+	net.PacketConn
+	conditions NetConditions
+
+	mutex sync.Mutex
+	rng   *rand.Rand // Separate from the global source the simulation draws on.
+}
+
+// listenNet opens a UDP socket on addr, which sends under the given conditions.
+func listenNet(addr string, conditions NetConditions) (net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if conditions == (NetConditions{}) {
+		return conn, nil
+	}
+	return &simulatedConn{PacketConn: conn, conditions: conditions, rng: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+}
+
+// WriteTo sends the packet after the simulated delay, unless it is lost. Like UDP it doesn't
+// report lost packets.
+func (c *simulatedConn) WriteTo(packet []byte, addr net.Addr) (int, error) {
+	c.mutex.Lock()
+	lost := c.rng.Float64() < c.conditions.loss
+	delay := c.conditions.latency
+	if c.conditions.jitter > 0 {
+		delay += time.Duration(c.rng.Int63n(int64(c.conditions.jitter)))
+	}
+	c.mutex.Unlock()
+
+	if lost {
+		return len(packet), nil
+	}
+	delayed := append([]byte(nil), packet...)
+	time.AfterFunc(delay, func() {
+		c.PacketConn.WriteTo(delayed, addr)
+	})
+	return len(packet), nil
+}
+
+// netPacket is a packet received from addr, or the error that stopped reception.
+type netPacket struct {
+	data []byte
+	addr net.Addr
+	err  error
+}
+
+// readPackets passes the packets received on conn to the channel, so that they can be handled
+// between updates. It stops after the first error, which is passed on too.
+func readPackets(conn net.PacketConn, packets chan<- netPacket) {
+	buf := make([]byte, netMaxPacket)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			packets <- netPacket{err: err}
+			return
+		}
+		packets <- netPacket{data: append([]byte(nil), buf[:n]...), addr: addr}
+	}
+}
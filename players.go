@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/faiface/pixel"
+)
+
+// Player is the state each player keeps between turns. In a two-player game they either take turns,
+// swapping whenever the current player loses a ship, or in co-op play at the same time.
+type Player struct {
+	number        int // 1-based.
+	score         int
+	lives         int     // Ships left in reserve.
+	level         int     // 0 until the player's first level starts.
+	nextShipScore int     // The score at which the next extra ship is awarded.
+	shieldEnergy  float64 // 0..1, shared by all of the player's ships.
+	rocks         []*Rock // The player's surviving Rocks, kept off the Stage while the other player has a turn.
+	ship          *Ship   // The player's ship in play, if any.
+	respawning    bool    // Waiting for the spawn area to clear before placing a new ship.
+}
+
+func makePlayer(game *Game, number int) *Player {
+	return &Player{number: number, lives: game.numberOfLives, nextShipScore: game.newShipPoints, shieldEnergy: 1}
+}
+
+// hasShip reports whether the player has a ship in play.
+func (p *Player) hasShip() bool {
+	return p.ship != nil && p.ship.stage.HasActor(p.ship)
+}
+
+// livesPool returns the player whose lives the player's ships come from: themselves, or player 1
+// when co-op players share their lives.
+func (g *Game) livesPool(player *Player) *Player {
+	if g.coop && g.sharedLives {
+		return g.players[0]
+	}
+	return player
+}
+
+// creditedPlayer returns the player credited with what the Actor destroys: the player whose ship
+// it is or fired it. Anything else is credited to the current player.
+func (g *Game) creditedPlayer(actor Actor) *Player {
+	if ship := shooterOf(actor); ship != nil && ship.player != nil {
+		return ship.player
+	}
+	return g.player
+}
+
+// hudColumn returns the x coordinate a player's part of the HUD is centered on. With one player it's
+// the middle of the screen. Otherwise each player has a column.
+func (g *Game) hudColumn(player *Player) float64 {
+	return g.stage.bounds.W() * (float64(player.number)/float64(len(g.players)+1) - 0.5)
+}
+
+// spawnPoint returns where the player's ships appear. In co-op the players are spread out across
+// the middle of the screen.
+func (g *Game) spawnPoint(player *Player) pixel.Vec {
+	if !g.coop {
+		return pixel.ZV
+	}
+	return pixel.V(g.stage.bounds.W()*0.1*(2*float64(player.number)-float64(len(g.players))-1), 0)
+}
+
+// updateShips replaces destroyed ships. It returns false once the game is over.
+func (g *Game) updateShips(dt float64) bool {
+	if g.coop {
+		return g.updateCoopShips()
+	}
+
+	// If the ship has been destroyed the next player with ships left gets a turn. With one player
+	// that's the same player again. The game is over when nobody has any left.
+	if player := g.player; !player.respawning && !player.hasShip() {
+		out := player.lives == 0
+		if out {
+			g.playerOut(player)
+		}
+		next := g.nextPlayer()
+		if next == nil {
+			g.gameOver()
+			return false
+		}
+		if next != player {
+			g.switchPlayer(next, out)
+		}
+		next.respawning = true
+	}
+
+	// Announce a new turn before it starts.
+	g.updateTurn(dt)
+
+	if g.turnTimer <= 0 {
+		g.spawnShip(g.player)
+	}
+	return true
+}
+
+// updateCoopShips respawns each player's ship while they have lives. The game is over when no
+// player has a ship in play or on the way.
+func (g *Game) updateCoopShips() bool {
+	playing := false
+	for _, player := range g.players {
+		if !player.respawning && !player.hasShip() && g.livesPool(player).lives > 0 {
+			player.respawning = true
+		}
+		g.spawnShip(player)
+		if player.respawning || player.hasShip() {
+			playing = true
+		}
+	}
+
+	if !playing {
+		for _, player := range g.players {
+			g.playerOut(player)
+		}
+		g.gameOver()
+		return false
+	}
+	return true
+}
+
+// spawnShip places the respawning player's new ship once no Rock is near the spawn point, taking it
+// from their lives. If the lives have run out meanwhile, e.g. a shared pool, the player must wait.
+func (g *Game) spawnShip(player *Player) {
+	if !player.respawning {
+		return
+	}
+	pool := g.livesPool(player)
+	if pool.lives <= 0 {
+		player.respawning = false
+		return
+	}
+	position := g.spawnPoint(player)
+	if g.stage.OverlapCircle(position, g.safeSpawnRadius, "rock") != nil {
+		return
+	}
+
+	player.respawning = false
+	pool.lives--
+	player.ship = makeShip(g, player)
+	player.ship.position = position
+}
+
+// maxCoopPlayers is the most players that can play co-op, each with their own gamepad.
+const maxCoopPlayers = 4
+
+// turnDiscarded are the Actors removed at the end of a turn, besides the Rocks which are kept.
+var turnDiscarded = mustParseQuery("projectile | pickup | effect")
+
+// nextPlayer returns the player whose turn is next: the first, after the current one, with a ship left.
+// It is the current player if nobody else has one, and nil once everybody is out.
+func (g *Game) nextPlayer() *Player {
+	for i := 1; i <= len(g.players); i++ {
+		player := g.players[(g.player.number-1+i)%len(g.players)]
+		if player.lives > 0 {
+			return player
+		}
+	}
+	return nil
+}
+
+// switchPlayer ends the current player's turn, stashing their Rocks, and brings back the next
+// player's. A banner announces whose turn it is before their ship appears.
+func (g *Game) switchPlayer(next *Player, previousOut bool) {
+	stage := g.stage
+	previous := g.player
+
+	previous.rocks = nil
+	for _, actor := range stage.FindActorsByKind("rock") {
+		stage.RemoveActor(actor)
+		previous.rocks = append(previous.rocks, actor.(*Rock))
+	}
+	for it := stage.Query(turnDiscarded); it.Next(); {
+		stage.RemoveActor(it.Actor())
+	}
+	if g.waveBanner != nil {
+		stage.RemoveActor(g.waveBanner)
+		g.waveBanner = nil
+	}
+	g.intermission = 0
+	g.audio.StopAll()
+
+	g.player = next
+	if next.rocks != nil {
+		for _, rock := range next.rocks {
+			stage.AddActor(rock)
+		}
+		next.rocks = nil
+		g.setLevel(next.level)
+	} else {
+		// A player who hasn't started, or was between levels, (re)starts the level from its intermission.
+		level := next.level
+		if level == 0 {
+			level = 1
+		}
+		g.newLevel(level)
+		g.intermission += g.turnLength
+	}
+
+	lines := []string{fmt.Sprintf("PLAYER %v", next.number)}
+	if previousOut {
+		lines = append([]string{fmt.Sprintf("GAME OVER PLAYER %v", previous.number), ""}, lines...)
+	}
+	if g.turnBanner != nil {
+		stage.RemoveActor(g.turnBanner)
+	}
+	g.turnBanner = makeTurnBanner(g, strings.Join(lines, "\n"))
+	g.turnTimer = g.turnLength
+}
+
+// updateTurn counts down the banner announcing a new turn.
+func (g *Game) updateTurn(dt float64) {
+	if g.turnTimer <= 0 {
+		return
+	}
+	g.turnTimer -= dt
+	if g.turnTimer <= 0 {
+		g.stage.RemoveActor(g.turnBanner)
+		g.turnBanner = nil
+	}
+}
+
+// makeTurnBanner shows whose turn it is in the middle of the screen.
+func makeTurnBanner(game *Game, text string) *TextActor {
+	t := MakeTextActor(pixel.V(0, 150), game.stage)
+	t.scale = 3
+	t.horizontalAlignment = "center"
+	t.SetText(text)
+
+	game.stage.AddActor(&t)
+	return &t
+}
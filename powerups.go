@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// PowerUpType defines a kind of pickup. To add one, add an entry to powerUpTypes and, for timed
+// effects, check Ship.hasPowerUp(name) wherever the effect applies.
+type PowerUpType struct {
+	name     string
+	label    string // Drawn inside the pickup.
+	color    color.Color
+	duration float64       // Seconds the effect lasts once collected. 0 for instant effects.
+	weight   float64       // Relative likelihood of being dropped.
+	weapon   string        // Optional. The Weapon the Ship uses for the duration or until it runs dry.
+	collect  func(s *Ship) // Optional. Called when the Ship picks it up.
+}
+
+var powerUpTypes = []PowerUpType{
+	{name: "spreadShot", label: "S", color: colornames.Orange, duration: 10, weight: 3, weapon: "spread"},
+	{name: "laser", label: "L", color: colornames.Red, duration: 10, weight: 2, weapon: "laser"},
+	{name: "missiles", label: "M", color: colornames.White, duration: 20, weight: 2, weapon: "missiles"},
+	{name: "rapidFire", label: "R", color: colornames.Yellow, duration: 10, weight: 3},
+	{name: "piercingShots", label: "P", color: colornames.Magenta, duration: 8, weight: 2},
+	{name: "shield", label: "O", color: colornames.Deepskyblue, duration: 6, weight: 2},
+	{name: "extraLife", label: "+", color: colornames.Limegreen, weight: 1,
+		collect: func(s *Ship) { s.game.addLife(s.player) }},
+}
+
+// randomPowerUpType picks a PowerUpType according to the weights.
+func randomPowerUpType() *PowerUpType {
+	total := 0.0
+	for _, t := range powerUpTypes {
+		total += t.weight
+	}
+	pick := rand.Float64() * total
+	for i := range powerUpTypes {
+		pick -= powerUpTypes[i].weight
+		if pick < 0 {
+			return &powerUpTypes[i]
+		}
+	}
+	return &powerUpTypes[len(powerUpTypes)-1]
+}
+
+// PowerUp is a pickup dropped by a destroyed Rock. It drifts, wrapping around the screen,
+// and blinks before it expires.
+type PowerUp struct {
+	BaseActor
+	game        *Game
+	powerUpType *PowerUpType
+	lifetime    float64
+	imd         *imdraw.IMDraw
+	txt         *text.Text
+}
+
+const powerUpRadius = 10.0
+
+func makePowerUp(game *Game, powerUpType *PowerUpType, position pixel.Vec) *PowerUp {
+	stage := game.stage
+	p := PowerUp{BaseActor: MakeBaseActor(stage, "powerUp"), game: game, powerUpType: powerUpType,
+		lifetime: game.powerUpLifetime, imd: imdraw.New(nil)}
+	p.position = position
+	p.velocity = pixel.Unit((math.Pi * 2) * rand.Float64()).Scaled(0.5)
+
+	p.txt = text.New(pixel.ZV, stage.textAtlas)
+	p.txt.Color = powerUpType.color
+	fmt.Fprint(p.txt, powerUpType.label)
+
+	stage.AddActor(&p)
+	return &p
+}
+
+func (p *PowerUp) Bounds() pixel.Rect {
+	return pixel.R(-powerUpRadius, -powerUpRadius, powerUpRadius, powerUpRadius)
+}
+
+func (p *PowerUp) ScaledBounds() pixel.Rect {
+	return p.Bounds().Moved(p.position)
+}
+
+// Update moves the PowerUp and expires it.
+func (p *PowerUp) Update(dt float64) {
+	stage := p.stage
+
+	p.lifetime -= dt
+	if p.lifetime < 0 {
+		stage.RemoveActor(p)
+		return
+	}
+
+	p.BaseActor.Update(dt)
+	wrapAroundVec(&p.position, &stage.bounds)
+}
+
+// OnCollide hands the PowerUp to the first Ship to touch it.
+func (p *PowerUp) OnCollide(other Actor) {
+	if ship, ok := other.(*Ship); ok {
+		p.stage.RemoveActor(p)
+		ship.collectPowerUp(p.powerUpType)
+	}
+}
+
+// Draw a labeled circle, blinking during the last two seconds.
+func (p *PowerUp) Draw() {
+	if p.lifetime < 2 && int(p.lifetime*8)%2 == 1 {
+		return
+	}
+
+	p.imd.Clear()
+	p.imd.Color = p.powerUpType.color
+	p.imd.Push(p.position)
+	p.imd.Circle(powerUpRadius, 2)
+	p.imd.Draw(p.stage.win)
+
+	labelBounds := p.txt.Bounds()
+	p.txt.Draw(p.stage.win, pixel.IM.Moved(p.position.Sub(labelBounds.Center())))
+}
+
+// collectPowerUp applies a PowerUpType's effect to the Ship.
+func (s *Ship) collectPowerUp(kind *PowerUpType) {
+	if kind.collect != nil {
+		kind.collect(s)
+	}
+	if kind.duration > 0 {
+		s.powerUps[kind.name] = kind.duration
+	}
+	if kind.weapon != "" {
+		s.weapon = makeWeapon(kind.weapon)
+		s.weaponPowerUp = kind.name
+	}
+	s.game.events.PublishPowerUpCollected(PowerUpCollected{Ship: s, Name: kind.name})
+}
+
+// hasPowerUp reports whether the named timed effect is active.
+func (s *Ship) hasPowerUp(name string) bool {
+	return s.powerUps[name] > 0
+}
+
+// updatePowerUps counts down the timed effects, dropping those that have run out.
+func (s *Ship) updatePowerUps(dt float64) {
+	for name := range s.powerUps {
+		s.powerUps[name] -= dt
+		if s.powerUps[name] <= 0 {
+			delete(s.powerUps, name)
+			if name == s.weaponPowerUp {
+				s.resetWeapon()
+			}
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/faiface/pixel"
+)
+
+// RaycastHit describes where a ray first crossed an Actor's collision polygon.
+type RaycastHit struct {
+	Actor    Actor
+	Point    pixel.Vec
+	Normal   pixel.Vec // Unit length, facing back toward the ray's origin.
+	Distance float64
+}
+
+// Raycast returns the Actors whose collision polygons the ray from origin along dir crosses within
+// maxDist, nearest first. dir needn't be unit length. If kinds are given only Actors of those kinds
+// are considered.
+func (s *Stage) Raycast(origin pixel.Vec, dir pixel.Vec, maxDist float64, kinds ...string) []RaycastHit {
+	dir = dir.Unit()
+	var hits []RaycastHit
+	for _, actor := range s.actorsOfKinds(kinds) {
+		if actor == nil {
+			continue
+		}
+
+		polygon := collisionPolygon(actor)
+		hit := RaycastHit{Actor: actor, Distance: math.MaxFloat64}
+		for i := range polygon {
+			p1 := polygon[i]
+			p2 := polygon[(i+1)%len(polygon)]
+			edge := p2.Sub(p1)
+			denom := dir.Cross(edge)
+			if denom == 0 {
+				continue
+			}
+			t := p1.Sub(origin).Cross(edge) / denom // Distance along the ray.
+			u := p1.Sub(origin).Cross(dir) / denom  // Fraction along the edge.
+			if t >= 0 && t <= maxDist && t < hit.Distance && u >= 0 && u <= 1 {
+				hit.Distance = t
+				hit.Normal = edge.Normal().Unit()
+			}
+		}
+
+		if hit.Distance != math.MaxFloat64 {
+			hit.Point = origin.Add(dir.Scaled(hit.Distance))
+			if hit.Normal.Dot(dir) > 0 {
+				hit.Normal = hit.Normal.Scaled(-1)
+			}
+			hits = append(hits, hit)
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Distance < hits[j].Distance })
+	return hits
+}
+
+// OverlapCircle returns the Actors whose collision polygons touch the circle, or nil if none.
+// If kinds are given only Actors of those kinds are considered.
+func (s *Stage) OverlapCircle(center pixel.Vec, radius float64, kinds ...string) []Actor {
+	var actors []Actor
+	for _, actor := range s.actorsOfKinds(kinds) {
+		if actor != nil && circleIntersectsPolygon(center, radius, collisionPolygon(actor)) {
+			actors = append(actors, actor)
+		}
+	}
+	return actors
+}
+
+// OverlapPolygon returns the Actors whose collision polygons intersect the convex polygon, or nil if
+// none. If kinds are given only Actors of those kinds are considered.
+func (s *Stage) OverlapPolygon(polygon Polygon, kinds ...string) []Actor {
+	var actors []Actor
+	for _, actor := range s.actorsOfKinds(kinds) {
+		if actor == nil {
+			continue
+		}
+		actorPolygon := collisionPolygon(actor)
+		if polygonsIntersect(&polygon, &actorPolygon) {
+			actors = append(actors, actor)
+		}
+	}
+	return actors
+}
+
+// actorsOfKinds returns the Actors of the kinds, by kind, or all of them if no kinds are given. Removed
+// Actors may leave nils among them.
+func (s *Stage) actorsOfKinds(kinds []string) []Actor {
+	switch len(kinds) {
+	case 0:
+		return s.allActors()
+	case 1:
+		return s.FindActorsByKind(kinds[0])
+	}
+	var actors []Actor
+	for _, kind := range kinds {
+		actors = append(actors, s.FindActorsByKind(kind)...)
+	}
+	return actors
+}
+
+// circleIntersectsPolygon reports whether a circle touches a convex polygon: either the center is
+// inside the polygon or some edge comes within radius of it.
+func circleIntersectsPolygon(center pixel.Vec, radius float64, polygon Polygon) bool {
+	inside := true
+	sign := 0.0
+	for i := range polygon {
+		p1 := polygon[i]
+		p2 := polygon[(i+1)%len(polygon)]
+		edge := p2.Sub(p1)
+
+		cross := edge.Cross(center.Sub(p1))
+		if sign == 0 {
+			sign = cross
+		} else if cross*sign < 0 {
+			inside = false
+		}
+
+		// Distance from the center to the closest point on the edge.
+		t := 0.0
+		if lengthSquared := edge.Dot(edge); lengthSquared > 0 {
+			t = math.Max(0, math.Min(1, center.Sub(p1).Dot(edge)/lengthSquared))
+		}
+		if p1.Add(edge.Scaled(t)).Sub(center).Len() <= radius {
+			return true
+		}
+	}
+	return inside && len(polygon) > 0
+}
+
+//
+
+// Query selects Actors by kind, tag and position. Its source combines:
+//
+//	word              Actors of that kind or with that tag, e.g. rock or enemy
+//	!q                Actors not matching q
+//	q & r, q | r      Actors matching both, or either. & binds tighter than |.
+//	(q)               grouping
+//	q within d of r   Actors matching q within distance d of another Actor matching r
+//	q within d        Actors matching q within distance d of the origin given to Stage.QueryFrom
+//
+// within binds loosest, but the r after of is only a word, a !, or a group: "q within 10 of a & b"
+// is an error, and "q within 10 of (a & b)" what's meant.
+//
+// e.g. "enemy & !shot within 200 of ship". Distances are measured the short way round the Stage's
+// wrapping edges. Parse a Query once, with parseQuery, and run it as often as needed.
+type Query struct {
+	source string
+	root   queryNode
+	start  string // A word every match has, so only its Actors need be checked, or "" to check all.
+}
+
+type queryNode interface {
+	matches(s *Stage, actor Actor, origin pixel.Vec) bool
+}
+
+type queryWord string
+
+type queryNot struct {
+	node queryNode
+}
+
+type queryAnd struct {
+	a, b queryNode
+}
+
+type queryOr struct {
+	a, b queryNode
+}
+
+type queryWithin struct {
+	node     queryNode
+	distance float64
+	of       queryNode // nil for the origin.
+	ofStart  string
+}
+
+func (q queryWord) matches(s *Stage, actor Actor, origin pixel.Vec) bool {
+	return actor.Kind() == string(q) || hasTag(actor, string(q))
+}
+
+func (q queryNot) matches(s *Stage, actor Actor, origin pixel.Vec) bool {
+	return !q.node.matches(s, actor, origin)
+}
+
+func (q queryAnd) matches(s *Stage, actor Actor, origin pixel.Vec) bool {
+	return q.a.matches(s, actor, origin) && q.b.matches(s, actor, origin)
+}
+
+func (q queryOr) matches(s *Stage, actor Actor, origin pixel.Vec) bool {
+	return q.a.matches(s, actor, origin) || q.b.matches(s, actor, origin)
+}
+
+func (q queryWithin) matches(s *Stage, actor Actor, origin pixel.Vec) bool {
+	if !q.node.matches(s, actor, origin) {
+		return false
+	}
+	position := s.WorldPosition(actor)
+	if q.of == nil {
+		return wrapDelta(position.Sub(origin), s.bounds).Len() <= q.distance
+	}
+	for _, other := range s.actorsNamed(q.ofStart) {
+		if other != nil && other != actor && s.HasActor(other) && q.of.matches(s, other, origin) &&
+			wrapDelta(position.Sub(s.WorldPosition(other)), s.bounds).Len() <= q.distance {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredWord returns a word every Actor matching the node has, or "" if there isn't one.
+func requiredWord(node queryNode) string {
+	switch n := node.(type) {
+	case queryWord:
+		return string(n)
+	case queryAnd:
+		if word := requiredWord(n.a); word != "" {
+			return word
+		}
+		return requiredWord(n.b)
+	case queryWithin:
+		return requiredWord(n.node)
+	}
+	return ""
+}
+
+// actorsNamed returns the Actors of the kind or with the tag, or every Actor if word is "" or names
+// both a kind and a tag. Removed Actors may leave nils among them.
+func (s *Stage) actorsNamed(word string) []Actor {
+	if word == "" {
+		return s.allActors()
+	}
+	byKind, byTag := s.FindActorsByKind(word), s.FindActorsByTag(word)
+	switch {
+	case byTag == nil:
+		return byKind
+	case byKind == nil:
+		return byTag
+	}
+	return s.allActors()
+}
+
+// QueryIterator steps through the Actors matching a Query, in the order they were added:
+//
+//	for it := stage.Query(q); it.Next(); {
+//		actor := it.Actor()
+//	}
+type QueryIterator struct {
+	stage  *Stage
+	query  *Query
+	origin pixel.Vec
+	actors []Actor
+	next   int
+	actor  Actor
+}
+
+// Query returns an iterator over the Actors matching the Query.
+func (s *Stage) Query(q *Query) QueryIterator {
+	return s.QueryFrom(q, pixel.ZV)
+}
+
+// QueryFrom returns an iterator over the Actors matching the Query, measuring "within" distances
+// without "of" from origin.
+func (s *Stage) QueryFrom(q *Query, origin pixel.Vec) QueryIterator {
+	return QueryIterator{stage: s, query: q, origin: origin, actors: s.actorsNamed(q.start)}
+}
+
+// Next moves to the next matching Actor, returning false once there are no more.
+func (it *QueryIterator) Next() bool {
+	for it.next < len(it.actors) {
+		actor := it.actors[it.next]
+		it.next++
+		if actor != nil && it.stage.HasActor(actor) && it.query.root.matches(it.stage, actor, it.origin) {
+			it.actor = actor
+			return true
+		}
+	}
+	it.actor = nil
+	return false
+}
+
+// Actor returns the matching Actor Next moved to.
+func (it *QueryIterator) Actor() Actor {
+	return it.actor
+}
+
+// parseQuery parses a Query's source.
+func parseQuery(source string) (*Query, error) {
+	tokens, err := tokenizeQuery(source)
+	if err != nil {
+		return nil, fmt.Errorf("query %q: %v", source, err)
+	}
+	p := queryParser{tokens: tokens}
+	root, err := p.parseWithin()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query %q: %v", source, err)
+	}
+	return &Query{source: source, root: root, start: requiredWord(root)}, nil
+}
+
+// mustParseQuery parses a Query's source, panicking if it's bad. It's meant for Queries written
+// into the game.
+func mustParseQuery(source string) *Query {
+	q, err := parseQuery(source)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *Query) String() string {
+	return q.source
+}
+
+func tokenizeQuery(source string) ([]string, error) {
+	var tokens []string
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("&|!()", r):
+			tokens = append(tokens, string(r))
+			i++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			return nil, fmt.Errorf("unexpected %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+// queryParser parses Query tokens by recursive descent, loosest binding first.
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// describe describes the next token for error messages.
+func (p *queryParser) describe() string {
+	if p.pos >= len(p.tokens) {
+		return "the end"
+	}
+	return strconv.Quote(p.tokens[p.pos])
+}
+
+func (p *queryParser) parseWithin() (queryNode, error) {
+	node, err := p.parseOr()
+	if err != nil || p.peek() != "within" {
+		return node, err
+	}
+	p.pos++
+	distance, err := strconv.ParseFloat(p.peek(), 64)
+	if err != nil || distance < 0 {
+		return nil, fmt.Errorf("expected a distance after within, not %v", p.describe())
+	}
+	p.pos++
+	within := queryWithin{node: node, distance: distance}
+	if p.peek() == "of" {
+		p.pos++
+		if within.of, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		within.ofStart = requiredWord(within.of)
+	}
+	return within, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	node, err := p.parseAnd()
+	for err == nil && p.peek() == "|" {
+		p.pos++
+		var b queryNode
+		if b, err = p.parseAnd(); err == nil {
+			node = queryOr{a: node, b: b}
+		}
+	}
+	return node, err
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	node, err := p.parseUnary()
+	for err == nil && p.peek() == "&" {
+		p.pos++
+		var b queryNode
+		if b, err = p.parseUnary(); err == nil {
+			node = queryAnd{a: node, b: b}
+		}
+	}
+	return node, err
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end")
+	case token == "!":
+		p.pos++
+		node, err := p.parseUnary()
+		return queryNot{node: node}, err
+	case token == "(":
+		p.pos++
+		node, err := p.parseWithin()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("expected ), not %v", p.describe())
+		}
+		p.pos++
+		return node, nil
+	case token == "within" || token == "of" || strings.ContainsAny(token, "&|)"):
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	p.pos++
+	return queryWord(token), nil
+}
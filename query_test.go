@@ -0,0 +1,310 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// boxActor is a square Actor with nothing to it but its bounds.
+type boxActor struct {
+	BaseActor
+	half float64 // Half the side.
+}
+
+func (b *boxActor) Bounds() pixel.Rect {
+	return pixel.R(-b.half, -b.half, b.half, b.half)
+}
+
+// addBox adds a square of the kind centered on center to the Stage.
+func addBox(stage *Stage, kind string, center pixel.Vec, half float64) *boxActor {
+	b := &boxActor{BaseActor: MakeBaseActor(stage, kind), half: half}
+	b.position = center
+	stage.AddActor(b)
+	return b
+}
+
+// makeTestStage makes an 800x600 headless Stage centered on the origin.
+func makeTestStage() *Stage {
+	stage := MakeStage(Stage{bounds: pixel.R(-400, -300, 400, 300)})
+	return &stage
+}
+
+func vecsNear(a pixel.Vec, b pixel.Vec) bool {
+	return a.Sub(b).Len() < 1e-9
+}
+
+func TestRaycast(t *testing.T) {
+	stage := makeTestStage()
+	near := addBox(stage, "rock", pixel.V(50, 0), 5)
+	far := addBox(stage, "rock", pixel.V(100, 0), 10)
+	beyond := addBox(stage, "rock", pixel.V(200, 0), 10)
+	ship := addBox(stage, "ship", pixel.V(0, 100), 10)
+
+	type hit struct {
+		actor    Actor
+		distance float64
+		normal   pixel.Vec
+	}
+	tests := []struct {
+		name    string
+		origin  pixel.Vec
+		dir     pixel.Vec
+		maxDist float64
+		kinds   []string
+		want    []hit
+	}{
+		{"nearest first", pixel.ZV, pixel.V(1, 0), 150, nil,
+			[]hit{{near, 45, pixel.V(-1, 0)}, {far, 90, pixel.V(-1, 0)}}},
+		{"dir needn't be unit length", pixel.ZV, pixel.V(3, 0), 150, nil,
+			[]hit{{near, 45, pixel.V(-1, 0)}, {far, 90, pixel.V(-1, 0)}}},
+		{"from the other side", pixel.V(300, 0), pixel.V(-1, 0), 300, nil,
+			[]hit{{beyond, 90, pixel.V(1, 0)}, {far, 190, pixel.V(1, 0)}, {near, 245, pixel.V(1, 0)}}},
+		{"up", pixel.ZV, pixel.V(0, 1), 150, nil, []hit{{ship, 90, pixel.V(0, -1)}}},
+		{"diagonal", pixel.V(-95, 0), pixel.V(1, 1), 200, nil, []hit{{ship, 90 * math.Sqrt2, pixel.V(0, -1)}}},
+		{"other kinds", pixel.ZV, pixel.V(1, 0), 150, []string{"ship"}, nil},
+		{"of the kind", pixel.ZV, pixel.V(0, 1), 150, []string{"ship", "shot"}, []hit{{ship, 90, pixel.V(0, -1)}}},
+		{"miss", pixel.ZV, pixel.V(0, -1), 1000, nil, nil},
+		{"too short", pixel.ZV, pixel.V(1, 0), 40, nil, nil},
+		{"along an edge", pixel.V(0, 10), pixel.V(1, 0), 150, nil, []hit{{far, 90, pixel.V(-1, 0)}}},
+	}
+	for _, test := range tests {
+		hits := stage.Raycast(test.origin, test.dir, test.maxDist, test.kinds...)
+		if len(hits) != len(test.want) {
+			t.Errorf("%v: got %v hits, want %v", test.name, len(hits), len(test.want))
+			continue
+		}
+		for i, want := range test.want {
+			got := hits[i]
+			point := test.origin.Add(test.dir.Unit().Scaled(want.distance))
+			if got.Actor != want.actor || math.Abs(got.Distance-want.distance) > 1e-9 ||
+				!vecsNear(got.Normal, want.normal) || !vecsNear(got.Point, point) {
+				t.Errorf("%v: hit %v is %v at %v, %v, normal %v, want %v at %v, %v, normal %v", test.name, i,
+					got.Actor.Kind(), got.Point, got.Distance, got.Normal, want.actor.Kind(), point, want.distance, want.normal)
+			}
+		}
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	stage := makeTestStage()
+	near := addBox(stage, "rock", pixel.V(50, 0), 5)
+	far := addBox(stage, "rock", pixel.V(100, 0), 10)
+	ship := addBox(stage, "ship", pixel.V(0, 100), 10)
+
+	circles := []struct {
+		name   string
+		center pixel.Vec
+		radius float64
+		kinds  []string
+		want   []Actor
+	}{
+		{"nothing", pixel.ZV, 40, nil, nil},
+		{"touching", pixel.ZV, 45, nil, []Actor{near}},
+		{"in order added", pixel.V(75, 0), 20, nil, []Actor{near, far}},
+		{"inside", pixel.V(101, 1), 1, nil, []Actor{far}},
+		{"other kinds", pixel.V(75, 0), 20, []string{"ship"}, nil},
+		{"everything", pixel.V(50, 50), 100, []string{"ship", "rock"}, []Actor{ship, near, far}},
+	}
+	for _, test := range circles {
+		if got := stage.OverlapCircle(test.center, test.radius, test.kinds...); !sameActors(got, test.want) {
+			t.Errorf("circle %v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	polygons := []struct {
+		name    string
+		polygon Polygon
+		kinds   []string
+		want    []Actor
+	}{
+		{"nothing", Polygon{pixel.V(-20, -20), pixel.V(20, -20), pixel.V(0, 20)}, nil, nil},
+		{"overlapping", Polygon{pixel.V(40, -20), pixel.V(60, -20), pixel.V(50, 20)}, nil, []Actor{near}},
+		{"inside", Polygon{pixel.V(99, -1), pixel.V(101, -1), pixel.V(100, 1)}, nil, []Actor{far}},
+		{"around", Polygon{pixel.V(-50, 50), pixel.V(50, 50), pixel.V(50, 150), pixel.V(-50, 150)}, nil, []Actor{ship}},
+		{"other kinds", Polygon{pixel.V(40, -20), pixel.V(60, -20), pixel.V(50, 20)}, []string{"ship"}, nil},
+	}
+	for _, test := range polygons {
+		if got := stage.OverlapPolygon(test.polygon, test.kinds...); !sameActors(got, test.want) {
+			t.Errorf("polygon %v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func sameActors(a []Actor, b []Actor) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCircleIntersectsPolygon(t *testing.T) {
+	square := Polygon{pixel.V(-10, -10), pixel.V(10, -10), pixel.V(10, 10), pixel.V(-10, 10)}
+	clockwise := Polygon{pixel.V(-10, -10), pixel.V(-10, 10), pixel.V(10, 10), pixel.V(10, -10)}
+	tests := []struct {
+		name    string
+		center  pixel.Vec
+		radius  float64
+		polygon Polygon
+		want    bool
+	}{
+		{"center inside", pixel.V(1, 2), 1, square, true},
+		{"center inside clockwise", pixel.V(1, 2), 1, clockwise, true},
+		{"around", pixel.ZV, 100, square, true},
+		{"tangent to an edge", pixel.V(15, 0), 5, square, true},
+		{"short of an edge", pixel.V(15, 0), 4.9, square, false},
+		{"short of an edge clockwise", pixel.V(15, 0), 4.9, clockwise, false},
+		{"over a corner", pixel.V(15, 15), 7.1, square, true},
+		{"short of a corner", pixel.V(15, 15), 7, square, false},
+		{"no polygon", pixel.ZV, 10, nil, false},
+	}
+	for _, test := range tests {
+		if got := circleIntersectsPolygon(test.center, test.radius, test.polygon); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	rock, ship, enemy := queryWord("rock"), queryWord("ship"), queryWord("enemy")
+	tests := []struct {
+		source string
+		want   queryNode
+		start  string
+	}{
+		{"rock", rock, "rock"},
+		{" rock\t", rock, "rock"},
+		{"!rock", queryNot{rock}, ""},
+		{"!!rock", queryNot{queryNot{rock}}, ""},
+		{"rock & ship", queryAnd{rock, ship}, "rock"},
+		{"!rock & ship", queryAnd{queryNot{rock}, ship}, "ship"},
+		{"rock | ship", queryOr{rock, ship}, ""},
+		{"rock | ship & enemy", queryOr{rock, queryAnd{ship, enemy}}, ""},
+		{"rock & ship | enemy", queryOr{queryAnd{rock, ship}, enemy}, ""},
+		{"(rock | ship) & enemy", queryAnd{queryOr{rock, ship}, enemy}, "enemy"},
+		{"rock & ship & enemy", queryAnd{queryAnd{rock, ship}, enemy}, "rock"},
+		{"rock within 10", queryWithin{node: rock, distance: 10}, "rock"},
+		{"rock | ship within 2.5", queryWithin{node: queryOr{rock, ship}, distance: 2.5}, ""},
+		{"rock within 10 of ship", queryWithin{node: rock, distance: 10, of: ship, ofStart: "ship"}, "rock"},
+		{"rock within 10 of !ship", queryWithin{node: rock, distance: 10, of: queryNot{ship}}, "rock"},
+		{"rock within 10 of (ship & enemy)",
+			queryWithin{node: rock, distance: 10, of: queryAnd{ship, enemy}, ofStart: "ship"}, "rock"},
+		{"(rock within 10 of ship) & enemy",
+			queryAnd{queryWithin{node: rock, distance: 10, of: ship, ofStart: "ship"}, enemy}, "rock"},
+	}
+	for _, test := range tests {
+		q, err := parseQuery(test.source)
+		if err != nil {
+			t.Errorf("%q: %v", test.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.root, test.want) {
+			t.Errorf("%q: got %#v, want %#v", test.source, q.root, test.want)
+		}
+		if q.start != test.start {
+			t.Errorf("%q: starts from %q, want %q", test.source, q.start, test.start)
+		}
+		if q.String() != test.source {
+			t.Errorf("%q: String() is %q", test.source, q)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"", `query "": unexpected end`},
+		{"rock &", `query "rock &": unexpected end`},
+		{"& rock", `query "& rock": unexpected "&"`},
+		{"rock ship", `query "rock ship": unexpected "ship"`},
+		{"rock # ship", `query "rock # ship": unexpected '#'`},
+		{"(rock", `query "(rock": expected ), not the end`},
+		{"(rock ship)", `query "(rock ship)": expected ), not "ship"`},
+		{"rock)", `query "rock)": unexpected ")"`},
+		{"rock within", `query "rock within": expected a distance after within, not the end`},
+		{"rock within far", `query "rock within far": expected a distance after within, not "far"`},
+		{"rock within -5", `query "rock within -5": unexpected '-'`},
+		{"rock within 10 of", `query "rock within 10 of": unexpected end`},
+		{"x within 10 of a & b", `query "x within 10 of a & b": unexpected "&"`},
+		{"rock within 10 within 20", `query "rock within 10 within 20": unexpected "within"`},
+		{"of ship", `query "of ship": unexpected "of"`},
+	}
+	for _, test := range tests {
+		if _, err := parseQuery(test.source); err == nil || err.Error() != test.want {
+			t.Errorf("%q: got error %v, want %v", test.source, err, test.want)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	stage := makeTestStage()
+	rock1 := addBox(stage, "rock", pixel.V(0, 0), 5)
+	rock2 := addBox(stage, "rock", pixel.V(395, 0), 5)
+	ship := addBox(stage, "ship", pixel.V(30, 0), 5)
+	shot := addBox(stage, "shot", pixel.V(385, 0), 1)
+	// A decoy is a ship only by its tag, just across the Stage's edge from rock2.
+	decoy := addBox(stage, "decoy", pixel.V(-395, 0), 5)
+	decoy.Tag("ship", "ship")
+	if tagged := stage.FindActorsByTag("ship"); !sameActors(tagged, []Actor{decoy}) {
+		t.Fatalf("tagged ship: %v", kindsOf(tagged))
+	}
+
+	tests := []struct {
+		source string
+		want   []Actor
+	}{
+		{"rock", []Actor{rock1, rock2}},
+		{"enemy", []Actor{rock1, rock2}},
+		{"decoy", []Actor{decoy}},
+		{"ship", []Actor{ship, decoy}},
+		{"player", []Actor{ship}},
+		{"!rock", []Actor{ship, shot, decoy}},
+		{"nothing", nil},
+		{"rock | ship & projectile", []Actor{rock1, rock2}},
+		{"(rock | ship) & projectile", nil},
+		{"(rock | ship) & player", []Actor{ship}},
+		{"ship & !player", []Actor{decoy}},
+		{"projectile | player within 40", []Actor{ship}},
+		{"rock within 20 of projectile", []Actor{rock2}},
+		{"ship within 20 of rock", []Actor{decoy}},
+		{"ship within 30 of rock", []Actor{ship, decoy}},
+		{"enemy within 30 of ship", []Actor{rock1, rock2}},
+		{"enemy within 30 of (ship & player)", []Actor{rock1}},
+		{"rock within 1000 of rock", []Actor{rock1, rock2}},
+		{"decoy within 1000 of decoy", nil},
+	}
+	for _, test := range tests {
+		var got []Actor
+		for it := stage.Query(mustParseQuery(test.source)); it.Next(); {
+			got = append(got, it.Actor())
+		}
+		if !sameActors(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.source, kindsOf(got), kindsOf(test.want))
+		}
+	}
+
+	var got []Actor
+	for it := stage.QueryFrom(mustParseQuery("enemy within 10"), pixel.V(390, 0)); it.Next(); {
+		got = append(got, it.Actor())
+	}
+	if !sameActors(got, []Actor{rock2}) {
+		t.Errorf("from 390,0: got %v, want the rock there", kindsOf(got))
+	}
+}
+
+func kindsOf(actors []Actor) []string {
+	var kinds []string
+	for _, actor := range actors {
+		kinds = append(kinds, actor.Kind())
+	}
+	return kinds
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/faiface/pixel"
+)
+
+// rockRadius is the nominal radius of an unscaled rock outline. It matches the
+// 32x32 sprite frames the rocks used to be drawn with so the generation scales still apply.
+const rockRadius = 16.0
+
+// RockShapeParams tunes the outlines generated for one rock generation.
+type RockShapeParams struct {
+	vertices  int     // Number of vertices around a freshly generated outline.
+	roughness float64 // 0 is a regular polygon, 1 lets vertices dip all the way to the center.
+	cutPoints int     // Number of jagged points added along each edge where a rock is split.
+}
+
+// rockShapeParams is indexed by generation-1.
+var rockShapeParams = []RockShapeParams{
+	{vertices: 12, roughness: 0.35, cutPoints: 2},
+	{vertices: 10, roughness: 0.3, cutPoints: 2},
+	{vertices: 8, roughness: 0.25, cutPoints: 1},
+}
+
+// RockShape is a procedurally generated rock outline in local, unscaled coordinates.
+// Generated outlines are star-shaped around the origin with their vertices sorted by angle.
+// Fragments keep the counter-clockwise order they were cut in, which sorting could tangle.
+type RockShape struct {
+	seed      int64
+	outline   Polygon
+	collision Polygon // Convex hull of outline, suitable for polygonsIntersect.
+}
+
+func rockShapeParamsFor(generation int) RockShapeParams {
+	if generation > len(rockShapeParams) {
+		generation = len(rockShapeParams)
+	}
+	return rockShapeParams[generation-1]
+}
+
+// generateRockShape creates a new rock outline. The same seed always produces the same shape.
+func generateRockShape(seed int64, params RockShapeParams) RockShape {
+	rng := rand.New(rand.NewSource(seed))
+
+	outline := make(Polygon, params.vertices)
+	step := math.Pi * 2 / float64(params.vertices)
+	for i := range outline {
+		// Jitter each vertex's angle within its slice so the outline isn't obviously regular.
+		angle := step*float64(i) + (rng.Float64()-0.5)*step*0.5
+		radius := rockRadius * (1 - params.roughness*rng.Float64())
+		outline[i] = pixel.Unit(angle).Scaled(radius)
+	}
+	sort.Slice(outline, func(i, j int) bool { return outline[i].Angle() < outline[j].Angle() })
+
+	return makeRockShape(seed, outline)
+}
+
+// fragmentRockShape breaks a rock outline into count angular pieces. Each piece is re-centered
+// on its own centroid and normalized to rockRadius. The returned offsets are the pieces'
+// centroids in the parent's local coordinates so callers can place them where they broke off.
+func fragmentRockShape(parent RockShape, count int, params RockShapeParams) ([]RockShape, []pixel.Vec) {
+	rng := rand.New(rand.NewSource(parent.seed))
+	shapes := make([]RockShape, count)
+	offsets := make([]pixel.Vec, count)
+
+	// Break around a point near, but not exactly at, the center.
+	core := pixel.V(rng.Float64()-0.5, rng.Float64()-0.5).Scaled(rockRadius * 0.3)
+	base := rng.Float64() * math.Pi * 2
+	sector := math.Pi * 2 / float64(count)
+
+	for i := 0; i < count; i++ {
+		a0 := base + sector*float64(i)
+		a1 := a0 + sector
+		start := outlinePointAt(parent.outline, a0)
+		end := outlinePointAt(parent.outline, a1)
+
+		piece := Polygon{}
+		piece = append(piece, jaggedCut(core, start, params, rng)...)
+		piece = append(piece, start)
+		piece = append(piece, outlineBetween(parent.outline, a0, a1)...)
+		piece = append(piece, end)
+		piece = append(piece, jaggedCut(end, core, params, rng)...)
+		piece = append(piece, core)
+
+		centroid := polygonCentroid(piece)
+		for j := range piece {
+			piece[j] = piece[j].Sub(centroid)
+		}
+
+		// Normalize so every generation shares rockRadius and Rock.scale alone sets the size.
+		maxRadius := 0.0
+		for _, v := range piece {
+			maxRadius = math.Max(maxRadius, v.Len())
+		}
+		if maxRadius > 0 {
+			for j := range piece {
+				piece[j] = piece[j].Scaled(rockRadius / maxRadius)
+			}
+		}
+
+		shapes[i] = makeRockShape(parent.seed*31+int64(i)+1, piece)
+		offsets[i] = centroid
+	}
+	return shapes, offsets
+}
+
+func makeRockShape(seed int64, outline Polygon) RockShape {
+	return RockShape{seed: seed, outline: outline, collision: convexHull(outline)}
+}
+
+// Bounds returns the smallest Rect containing the outline.
+func (r *RockShape) Bounds() pixel.Rect {
+	bounds := pixel.Rect{Min: r.outline[0], Max: r.outline[0]}
+	for _, v := range r.outline[1:] {
+		bounds.Min = pixel.V(math.Min(bounds.Min.X, v.X), math.Min(bounds.Min.Y, v.Y))
+		bounds.Max = pixel.V(math.Max(bounds.Max.X, v.X), math.Max(bounds.Max.Y, v.Y))
+	}
+	return bounds
+}
+
+// jaggedCut returns roughened points strictly between from and to.
+func jaggedCut(from pixel.Vec, to pixel.Vec, params RockShapeParams, rng *rand.Rand) Polygon {
+	edge := to.Sub(from)
+	normal := edge.Normal().Unit()
+	points := make(Polygon, params.cutPoints)
+	for i := range points {
+		t := float64(i+1) / float64(params.cutPoints+1)
+		jitter := (rng.Float64() - 0.5) * params.roughness * edge.Len() * 0.5
+		points[i] = from.Add(edge.Scaled(t)).Add(normal.Scaled(jitter))
+	}
+	return points
+}
+
+// outlinePointAt returns where a ray from the origin at angle crosses a star-shaped outline.
+func outlinePointAt(outline Polygon, angle float64) pixel.Vec {
+	dir := pixel.Unit(angle)
+	for i := range outline {
+		p1 := outline[i]
+		p2 := outline[(i+1)%len(outline)]
+		edge := p2.Sub(p1)
+		denom := dir.Cross(edge)
+		if denom == 0 {
+			continue
+		}
+		t := p1.Cross(edge) / denom // Distance along the ray.
+		u := p1.Cross(dir) / denom  // Fraction along the edge.
+		if t >= 0 && u >= 0 && u <= 1 {
+			return dir.Scaled(t)
+		}
+	}
+	return dir.Scaled(rockRadius)
+}
+
+// outlineBetween returns the vertices of a star-shaped outline within the counter-clockwise sweep
+// from a0 to a1, in that order, even where the sweep wraps past the first vertex.
+func outlineBetween(outline Polygon, a0 float64, a1 float64) Polygon {
+	var between Polygon
+	for _, v := range outline {
+		if angleBetween(v.Angle(), a0, a1) {
+			between = append(between, v)
+		}
+	}
+	offset := func(v pixel.Vec) float64 { return math.Mod(v.Angle()-a0+math.Pi*4, math.Pi*2) }
+	sort.Slice(between, func(i, j int) bool { return offset(between[i]) < offset(between[j]) })
+	return between
+}
+
+// angleBetween reports whether angle lies within the counter-clockwise sweep from a0 to a1.
+func angleBetween(angle float64, a0 float64, a1 float64) bool {
+	sweep := math.Mod(a1-a0+math.Pi*4, math.Pi*2)
+	offset := math.Mod(angle-a0+math.Pi*4, math.Pi*2)
+	return offset > 0 && offset < sweep
+}
+
+// polygonCentroid returns the area-weighted centroid of a simple polygon.
+func polygonCentroid(p Polygon) pixel.Vec {
+	area := 0.0
+	centroid := pixel.ZV
+	for i := range p {
+		p1 := p[i]
+		p2 := p[(i+1)%len(p)]
+		cross := p1.Cross(p2)
+		area += cross
+		centroid = centroid.Add(p1.Add(p2).Scaled(cross))
+	}
+	if area == 0 {
+		return p[0]
+	}
+	return centroid.Scaled(1 / (3 * area))
+}
+
+// convexHull returns the convex hull of the points in counter-clockwise order (Andrew's monotone chain).
+func convexHull(points Polygon) Polygon {
+	sorted := make(Polygon, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].X == sorted[j].X {
+			return sorted[i].Y < sorted[j].Y
+		}
+		return sorted[i].X < sorted[j].X
+	})
+
+	hull := make(Polygon, 0, len(sorted)*2)
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for _, v := range sorted {
+			for len(hull) >= start+2 && hull[len(hull)-1].Sub(hull[len(hull)-2]).Cross(v.Sub(hull[len(hull)-2])) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, v)
+		}
+		// The last point of each pass is the first point of the next.
+		hull = hull[:len(hull)-1]
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		}
+	}
+	return hull
+}
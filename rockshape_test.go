@@ -0,0 +1,142 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// checkSimplePolygon fails the test unless the polygon winds counter-clockwise and no two of its edges
+// cross.
+func checkSimplePolygon(t *testing.T, name string, p Polygon) {
+	t.Helper()
+	if len(p) < 3 {
+		t.Errorf("%v has %v points", name, len(p))
+		return
+	}
+	area := 0.0
+	for i := range p {
+		area += p[i].Cross(p[(i+1)%len(p)])
+	}
+	if area <= 0 {
+		t.Errorf("%v has area %v", name, area/2)
+	}
+	for i := range p {
+		for j := i + 2; j < len(p); j++ {
+			if i == 0 && j == len(p)-1 {
+				continue // Adjacent round the end.
+			}
+			if segmentsCross(p[i], p[(i+1)%len(p)], p[j], p[(j+1)%len(p)]) {
+				t.Errorf("%v crosses itself, edges %v and %v: %v", name, i, j, p)
+				return
+			}
+		}
+	}
+}
+
+// segmentsCross reports whether a1-a2 and b1-b2 cross at a point inside both.
+func segmentsCross(a1, a2, b1, b2 pixel.Vec) bool {
+	d1 := a2.Sub(a1).Cross(b1.Sub(a1))
+	d2 := a2.Sub(a1).Cross(b2.Sub(a1))
+	d3 := b2.Sub(b1).Cross(a1.Sub(b1))
+	d4 := b2.Sub(b1).Cross(a2.Sub(b1))
+	return d1*d2 < 0 && d3*d4 < 0
+}
+
+func TestGenerateRockShape(t *testing.T) {
+	for generation := 1; generation <= len(rockShapeParams); generation++ {
+		params := rockShapeParamsFor(generation)
+		for seed := int64(1); seed <= 50; seed++ {
+			shape := generateRockShape(seed, params)
+			if again := generateRockShape(seed, params); !reflect.DeepEqual(shape, again) {
+				t.Fatalf("generation %v seed %v: the same seed gave different shapes", generation, seed)
+			}
+			if len(shape.outline) != params.vertices {
+				t.Errorf("generation %v seed %v: %v vertices, want %v", generation, seed, len(shape.outline), params.vertices)
+			}
+			checkSimplePolygon(t, "outline", shape.outline)
+			checkSimplePolygon(t, "collision polygon", shape.collision)
+		}
+	}
+}
+
+func TestFragmentRockShape(t *testing.T) {
+	for _, count := range []int{2, 3} {
+		for seed := int64(1); seed <= 50; seed++ {
+			checkFragments(t, seed, count)
+		}
+	}
+}
+
+// checkFragments breaks up a rock, and its fragments, down to the smallest generation.
+func checkFragments(t *testing.T, seed int64, count int) {
+	t.Helper()
+	{
+		parent := generateRockShape(seed, rockShapeParamsFor(1))
+		shapes := []RockShape{parent}
+		for generation := 2; generation <= len(rockShapeParams); generation++ {
+			params := rockShapeParamsFor(generation)
+			var fragments []RockShape
+			for _, shape := range shapes {
+				pieces, offsets := fragmentRockShape(shape, count, params)
+				again, againOffsets := fragmentRockShape(shape, count, params)
+				if !reflect.DeepEqual(pieces, again) || !reflect.DeepEqual(offsets, againOffsets) {
+					t.Fatalf("seed %v: the same shape broke up differently", seed)
+				}
+				if len(pieces) != count || len(offsets) != count {
+					t.Fatalf("seed %v: %v pieces and %v offsets, want %v", seed, len(pieces), len(offsets), count)
+				}
+				for _, piece := range pieces {
+					checkSimplePolygon(t, "fragment", piece.outline)
+					checkSimplePolygon(t, "fragment collision polygon", piece.collision)
+				}
+				fragments = append(fragments, pieces...)
+			}
+			shapes = fragments
+		}
+	}
+}
+
+func TestConvexHull(t *testing.T) {
+	tests := []struct {
+		name   string
+		points Polygon
+		want   Polygon
+	}{
+		{"square", Polygon{pixel.V(2, 2), pixel.V(0, 0), pixel.V(0, 2), pixel.V(2, 0)},
+			Polygon{pixel.V(0, 0), pixel.V(2, 0), pixel.V(2, 2), pixel.V(0, 2)}},
+		{"inner and edge points", Polygon{pixel.V(0, 0), pixel.V(1, 1), pixel.V(1, 0), pixel.V(2, 0), pixel.V(2, 2), pixel.V(0, 2)},
+			Polygon{pixel.V(0, 0), pixel.V(2, 0), pixel.V(2, 2), pixel.V(0, 2)}},
+		{"concave", Polygon{pixel.V(0, 0), pixel.V(4, 0), pixel.V(2, 1), pixel.V(4, 4), pixel.V(0, 4)},
+			Polygon{pixel.V(0, 0), pixel.V(4, 0), pixel.V(4, 4), pixel.V(0, 4)}},
+		{"triangle", Polygon{pixel.V(0, 3), pixel.V(0, 0), pixel.V(3, 0)},
+			Polygon{pixel.V(0, 0), pixel.V(3, 0), pixel.V(0, 3)}},
+	}
+	for _, test := range tests {
+		if got := convexHull(test.points); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPolygonCentroid(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon Polygon
+		want    pixel.Vec
+	}{
+		{"square", Polygon{pixel.V(0, 0), pixel.V(2, 0), pixel.V(2, 2), pixel.V(0, 2)}, pixel.V(1, 1)},
+		{"clockwise square", Polygon{pixel.V(0, 0), pixel.V(0, 2), pixel.V(2, 2), pixel.V(2, 0)}, pixel.V(1, 1)},
+		{"triangle", Polygon{pixel.V(0, 0), pixel.V(3, 0), pixel.V(0, 3)}, pixel.V(1, 1)},
+		// An L of two 2x1 rectangles, weighted by area rather than by vertex.
+		{"L", Polygon{pixel.V(0, 0), pixel.V(2, 0), pixel.V(2, 1), pixel.V(1, 1), pixel.V(1, 3), pixel.V(0, 3)},
+			pixel.V(0.75, 1.25)},
+		{"flat", Polygon{pixel.V(1, 1), pixel.V(2, 2), pixel.V(3, 3)}, pixel.V(1, 1)},
+	}
+	for _, test := range tests {
+		if got := polygonCentroid(test.polygon); got.Sub(test.want).Len() > 1e-9 {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+)
+
+// savedGame is the state of a Game at some moment, which can be restored to roll back and
+// re-simulate. Restoring puts the same objects back the way they were, rather than making new
+// ones, so the references between them (a Ship's Player, a Shot's shooter) stay valid. Objects
+// made since are simply forgotten.
+type savedGame struct {
+	restore []func()
+}
+
+// saveGame saves the Game, its Stage, Players and every Actor on the Stage or kept off it.
+func saveGame(g *Game) *savedGame {
+	s := &savedGame{}
+	s.restore = append(s.restore, saveValue(g), saveStage(g.stage))
+	for _, player := range g.players {
+		s.restore = append(s.restore, saveValue(player))
+		for _, rock := range player.rocks {
+			s.restore = append(s.restore, saveActor(rock))
+		}
+	}
+	for _, actor := range g.stage.actors {
+		if actor != nil {
+			s.restore = append(s.restore, saveActor(actor))
+		}
+	}
+	return s
+}
+
+// restoreGame puts the Game back the way it was when saved. A savedGame can be restored any number
+// of times.
+func (s *savedGame) restoreGame() {
+	for _, restore := range s.restore {
+		restore()
+	}
+}
+
+// saveValue returns a function that sets what ptr points to back to its current value. The copy is
+// shallow: maps and slices that are modified in place must be copied separately.
+func saveValue(ptr interface{}) func() {
+	value := reflect.ValueOf(ptr).Elem()
+	saved := reflect.New(value.Type()).Elem()
+	saved.Set(value)
+	return func() {
+		value.Set(saved)
+	}
+}
+
+func saveStage(stage *Stage) func() {
+	actors := append([]Actor(nil), stage.actors...)
+	slots := copySlots(stage.slots)
+	freeSlots := append([]int(nil), stage.freeSlots...)
+	removed := stage.removed
+	kinds, tags := copyIndexes(stage.kinds), copyIndexes(stage.tags)
+	nextActorID := stage.nextActorID
+	world := stage.world.clone()
+	return func() {
+		stage.actors = append([]Actor(nil), actors...)
+		stage.slots = copySlots(slots)
+		stage.freeSlots = append([]int(nil), freeSlots...)
+		stage.removed = removed
+		stage.kinds, stage.tags = copyIndexes(kinds), copyIndexes(tags)
+		stage.nextActorID = nextActorID
+		stage.world = world.clone()
+	}
+}
+
+func copySlots(slots []actorSlot) []actorSlot {
+	copied := append([]actorSlot(nil), slots...)
+	for i := range copied {
+		copied[i].children = append([]ActorHandle(nil), slots[i].children...)
+	}
+	return copied
+}
+
+func copyIndexes(indexes map[string]*actorIndex) map[string]*actorIndex {
+	copied := make(map[string]*actorIndex, len(indexes))
+	for name, index := range indexes {
+		// The Actors list is never changed once handed out, only appended to, so it can be shared.
+		copied[name] = &actorIndex{handles: append([]ActorHandle(nil), index.handles...),
+			actors: index.actors[:len(index.actors):len(index.actors)], stale: index.stale}
+	}
+	return copied
+}
+
+// saveActor saves an Actor along with the state it keeps in maps, slices and Weapons.
+func saveActor(actor Actor) func() {
+	restore := saveValue(actor)
+	switch a := actor.(type) {
+	case *Ship:
+		powerUps := copyPowerUps(a.powerUps)
+		restoreWeapon := saveWeapon(a.weapon)
+		return func() {
+			restore()
+			a.powerUps = copyPowerUps(powerUps)
+			restoreWeapon()
+		}
+	case *Shot:
+		ignore := copyIgnored(a.ignore)
+		return func() {
+			restore()
+			a.ignore = copyIgnored(ignore)
+		}
+	}
+	return restore
+}
+
+func saveWeapon(weapon Weapon) func() {
+	restore := saveValue(weapon)
+	if gun, ok := weapon.(*Gun); ok {
+		live := append([]Actor(nil), gun.live...)
+		return func() {
+			restore()
+			gun.live = append([]Actor(nil), live...)
+		}
+	}
+	return restore
+}
+
+func copyPowerUps(powerUps map[string]float64) map[string]float64 {
+	copied := make(map[string]float64, len(powerUps))
+	for name, left := range powerUps {
+		copied[name] = left
+	}
+	return copied
+}
+
+func copyIgnored(ignore map[*Rock]bool) map[*Rock]bool {
+	if ignore == nil {
+		return nil
+	}
+	copied := make(map[*Rock]bool, len(ignore))
+	for rock, ignored := range ignore {
+		copied[rock] = ignored
+	}
+	return copied
+}
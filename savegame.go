@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+)
+
+// saveVersion is the version of the save format written. Files from later versions are refused.
+// Fields may be added without a new version: older files simply lack them and load with zero values.
+const saveVersion = 1
+
+// saveMagic starts a binary save file. A JSON one starts with "{".
+const saveMagic = "GOROCKS\x00"
+
+// SaveFile is a saved game. It has the game's rules state and the gameplay Actors: Rocks, Ships,
+// projectiles and PowerUps. The HUD is made afresh on load, and sounds and banners aren't saved.
+//
+// It is written as indented JSON, or as a compact binary file: saveMagic followed by the gob
+// encoding of the same struct.
+type SaveFile struct {
+	Version int         `json:"version"`
+	Game    GameSave    `json:"game"`
+	Actors  []ActorSave `json:"actors"` // In Stage order.
+}
+
+// GameSave is the state of the Game in a SaveFile.
+type GameSave struct {
+	Coop         bool         `json:"coop"`
+	Player       int          `json:"player"` // Whose turn it is.
+	Players      []PlayerSave `json:"players"`
+	Intermission float64      `json:"intermission,omitempty"`
+	TurnTimer    float64      `json:"turnTimer,omitempty"`
+}
+
+// PlayerSave is a Player in a SaveFile.
+type PlayerSave struct {
+	Number        int         `json:"number"`
+	Score         int         `json:"score"`
+	Lives         int         `json:"lives"`
+	Level         int         `json:"level"`
+	NextShipScore int         `json:"nextShipScore"`
+	ShieldEnergy  float64     `json:"shieldEnergy"`
+	Respawning    bool        `json:"respawning,omitempty"`
+	Ship          int         `json:"ship,omitempty"`  // ID of the player's Ship, if it's in play.
+	Rocks         []ActorSave `json:"rocks,omitempty"` // Kept off the Stage while another player has a turn.
+}
+
+// ActorSave is an Actor in a SaveFile. IDs are the Actors' IDs on the Stage when saved, and are
+// only used for references between Actors. Fields after the first few depend on the kind.
+type ActorSave struct {
+	ID               int       `json:"id"`
+	Kind             string    `json:"kind"`
+	Position         pixel.Vec `json:"position"`
+	Rotation         float64   `json:"rotation"`
+	Scale            float64   `json:"scale"`
+	Velocity         pixel.Vec `json:"velocity"`
+	RotationVelocity float64   `json:"rotationVelocity"`
+
+	Generation int     `json:"generation,omitempty"` // Rock.
+	Seed       int64   `json:"seed,omitempty"`       // Rock shape.
+	Outline    Polygon `json:"outline,omitempty"`    // Rock shape.
+
+	Player          int                `json:"player,omitempty"` // Ship.
+	Weapon          *WeaponSave        `json:"weapon,omitempty"`
+	PowerUps        map[string]float64 `json:"powerUps,omitempty"`
+	WeaponPowerUp   string             `json:"weaponPowerUp,omitempty"`
+	HyperspaceTimer float64            `json:"hyperspaceTimer,omitempty"`
+	SpecialHeld     bool               `json:"specialHeld,omitempty"`
+	Thrusting       bool               `json:"thrusting,omitempty"`
+	Shielded        bool               `json:"shielded,omitempty"`
+
+	Shooter  int        `json:"shooter,omitempty"` // Shot, Missile and LaserBeam.
+	Timeout  float64    `json:"timeout,omitempty"`
+	Pierce   int        `json:"pierce,omitempty"` // Shot.
+	Ignore   []int      `json:"ignore,omitempty"`
+	Speed    float64    `json:"speed,omitempty"` // Missile.
+	TurnRate float64    `json:"turnRate,omitempty"`
+	End      *pixel.Vec `json:"end,omitempty"` // LaserBeam.
+
+	PowerUp  string  `json:"powerUp,omitempty"` // PowerUp.
+	Lifetime float64 `json:"lifetime,omitempty"`
+}
+
+// WeaponSave is a Ship's Weapon in a SaveFile.
+type WeaponSave struct {
+	Name       string  `json:"name"`
+	Timer      float64 `json:"timer,omitempty"`
+	Heat       float64 `json:"heat,omitempty"`
+	Overheated bool    `json:"overheated,omitempty"`
+	Ammo       int     `json:"ammo"`
+	Live       []int   `json:"live,omitempty"` // IDs of its projectiles.
+}
+
+// actorSaver saves and loads a kind of Actor. load makes the Actor, on the Stage, from the saved
+// fields particular to its kind; the common ones are set afterwards. link restores references to
+// other Actors once they have all been made.
+type actorSaver struct {
+	save func(actor Actor, save *ActorSave, ids func(Actor) int)
+	load func(game *Game, save *ActorSave) Actor
+	link func(actor Actor, save *ActorSave, actors map[int]Actor) // Optional.
+}
+
+// actorSavers is the registry of the kinds of Actor that are saved. To save another kind, add it here.
+var actorSavers = map[string]actorSaver{
+	"rock": {
+		save: func(actor Actor, save *ActorSave, ids func(Actor) int) {
+			rock := actor.(*Rock)
+			save.Generation = rock.generation
+			save.Seed = rock.shape.seed
+			save.Outline = rock.shape.outline
+		},
+		load: func(game *Game, save *ActorSave) Actor {
+			shape := makeRockShape(save.Seed, append(Polygon(nil), save.Outline...))
+			return makeRock(game, save.Generation, &shape)
+		},
+	},
+	"ship": {
+		save: func(actor Actor, save *ActorSave, ids func(Actor) int) {
+			ship := actor.(*Ship)
+			save.Player = ship.player.number
+			if gun, ok := ship.weapon.(*Gun); ok {
+				save.Weapon = &WeaponSave{Name: gun.name, Timer: gun.timer, Heat: gun.heat, Overheated: gun.overheated, Ammo: gun.ammo}
+				for _, projectile := range gun.live {
+					if id := ids(projectile); id != 0 {
+						save.Weapon.Live = append(save.Weapon.Live, id)
+					}
+				}
+			}
+			save.PowerUps = ship.powerUps
+			save.WeaponPowerUp = ship.weaponPowerUp
+			save.HyperspaceTimer = ship.hyperspaceTimer
+			save.SpecialHeld = ship.specialHeld
+			save.Thrusting = ship.thrusting
+			save.Shielded = ship.shielded
+		},
+		load: func(game *Game, save *ActorSave) Actor {
+			ship := makeShip(game, game.players[save.Player-1])
+			if save.Weapon != nil {
+				ship.weapon = makeWeapon(save.Weapon.Name)
+				if gun, ok := ship.weapon.(*Gun); ok {
+					gun.timer, gun.heat, gun.overheated, gun.ammo = save.Weapon.Timer, save.Weapon.Heat, save.Weapon.Overheated, save.Weapon.Ammo
+				}
+			}
+			for name, left := range save.PowerUps {
+				ship.powerUps[name] = left
+			}
+			ship.weaponPowerUp = save.WeaponPowerUp
+			ship.hyperspaceTimer = save.HyperspaceTimer
+			ship.specialHeld = save.SpecialHeld
+			ship.shielded = save.Shielded
+			if save.Thrusting {
+				ship.thrusting = true
+				game.events.PublishShipThrust(ShipThrust{Ship: ship, Thrusting: true})
+			}
+			return ship
+		},
+		link: func(actor Actor, save *ActorSave, actors map[int]Actor) {
+			gun, ok := actor.(*Ship).weapon.(*Gun)
+			if !ok || save.Weapon == nil {
+				return
+			}
+			for _, id := range save.Weapon.Live {
+				if projectile := actors[id]; projectile != nil {
+					gun.live = append(gun.live, projectile)
+				}
+			}
+		},
+	},
+	"shot": {
+		save: func(actor Actor, save *ActorSave, ids func(Actor) int) {
+			shot := actor.(*Shot)
+			save.Shooter = ids(shot.shooter)
+			save.Timeout = shot.timeout
+			save.Pierce = shot.pierce
+			for rock := range shot.ignore {
+				if id := ids(rock); id != 0 {
+					save.Ignore = append(save.Ignore, id)
+				}
+			}
+			sort.Ints(save.Ignore)
+		},
+		load: func(game *Game, save *ActorSave) Actor {
+			shot := makeShot(save.Position, save.Velocity, game.stage, game)
+			shot.timeout = save.Timeout
+			shot.pierce = save.Pierce
+			return shot
+		},
+		link: func(actor Actor, save *ActorSave, actors map[int]Actor) {
+			shot := actor.(*Shot)
+			shot.shooter, _ = actors[save.Shooter].(*Ship)
+			for _, id := range save.Ignore {
+				if rock, ok := actors[id].(*Rock); ok {
+					if shot.ignore == nil {
+						shot.ignore = make(map[*Rock]bool)
+					}
+					shot.ignore[rock] = true
+				}
+			}
+		},
+	},
+	"missile": {
+		save: func(actor Actor, save *ActorSave, ids func(Actor) int) {
+			missile := actor.(*Missile)
+			save.Shooter = ids(missile.shooter)
+			save.Timeout = missile.timeout
+			save.Speed = missile.speed
+			save.TurnRate = missile.turnRate
+		},
+		load: func(game *Game, save *ActorSave) Actor {
+			stage := game.stage
+			m := Missile{WrapAroundActor: makeWrapAroundActor(6, stage, "missile"), game: game,
+				timeout: save.Timeout, speed: save.Speed, turnRate: save.TurnRate}
+			stage.AddActor(&m)
+			return &m
+		},
+		link: func(actor Actor, save *ActorSave, actors map[int]Actor) {
+			actor.(*Missile).shooter, _ = actors[save.Shooter].(*Ship)
+		},
+	},
+	"beam": {
+		save: func(actor Actor, save *ActorSave, ids func(Actor) int) {
+			beam := actor.(*LaserBeam)
+			save.Shooter = ids(beam.shooter)
+			save.Timeout = beam.timeout
+			end := beam.end
+			save.End = &end
+		},
+		load: func(game *Game, save *ActorSave) Actor {
+			// Not makeLaserBeam, which would fire it again.
+			if save.End == nil {
+				return nil
+			}
+			stage := game.stage
+			b := LaserBeam{BaseActor: MakeBaseActor(stage, "beam"), end: *save.End, timeout: save.Timeout, imd: imdraw.New(nil)}
+			stage.AddActor(&b)
+			return &b
+		},
+		link: func(actor Actor, save *ActorSave, actors map[int]Actor) {
+			actor.(*LaserBeam).shooter, _ = actors[save.Shooter].(*Ship)
+		},
+	},
+	"powerUp": {
+		save: func(actor Actor, save *ActorSave, ids func(Actor) int) {
+			powerUp := actor.(*PowerUp)
+			save.PowerUp = powerUp.powerUpType.name
+			save.Lifetime = powerUp.lifetime
+		},
+		load: func(game *Game, save *ActorSave) Actor {
+			for i := range powerUpTypes {
+				if powerUpTypes[i].name == save.PowerUp {
+					powerUp := makePowerUp(game, &powerUpTypes[i], save.Position)
+					powerUp.lifetime = save.Lifetime
+					return powerUp
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// saveActor saves an Actor of a registered kind.
+func (g *Game) saveActor(actor Actor) ActorSave {
+	save := ActorSave{ID: g.stage.ActorID(actor), Kind: actor.Kind(), Position: actor.Position(),
+		Rotation: actor.Rotation(), Scale: actor.Scale(), Velocity: actor.Velocity()}
+	save.RotationVelocity = actor.(interface{ baseActor() *BaseActor }).baseActor().rotationVelocity
+	actorSavers[save.Kind].save(actor, &save, g.stashedActorID)
+	return save
+}
+
+// stashedActorID returns the ID of an Actor on the Stage or, for Rocks kept off it, a negative ID
+// unique within the save.
+func (g *Game) stashedActorID(actor Actor) int {
+	if id := g.stage.ActorID(actor); id != 0 {
+		return id
+	}
+	id := 0
+	for _, player := range g.players {
+		for _, rock := range player.rocks {
+			id--
+			if Actor(rock) == actor {
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// save returns the game in play as a SaveFile.
+func (g *Game) save() SaveFile {
+	file := SaveFile{Version: saveVersion, Game: GameSave{Coop: g.coop, Intermission: g.intermission,
+		TurnTimer: g.turnTimer}}
+	// Between games, e.g. on the title, there is no player.
+	if g.player != nil {
+		file.Game.Player = g.player.number
+	}
+	for _, player := range g.players {
+		save := PlayerSave{Number: player.number, Score: player.score, Lives: player.lives, Level: player.level,
+			NextShipScore: player.nextShipScore, ShieldEnergy: player.shieldEnergy, Respawning: player.respawning}
+		if player.hasShip() {
+			save.Ship = g.stage.ActorID(player.ship)
+		}
+		for _, rock := range player.rocks {
+			rockSave := g.saveActor(rock)
+			rockSave.ID = g.stashedActorID(rock)
+			save.Rocks = append(save.Rocks, rockSave)
+		}
+		file.Game.Players = append(file.Game.Players, save)
+	}
+	for _, actor := range g.stage.actors {
+		if actor == nil {
+			continue
+		}
+		if _, ok := actorSavers[actor.Kind()]; ok {
+			file.Actors = append(file.Actors, g.saveActor(actor))
+		}
+	}
+	return file
+}
+
+// checkActorSave returns an error if the saved Actor couldn't be loaded into a game of that many players.
+func checkActorSave(actor ActorSave, players int) error {
+	if _, ok := actorSavers[actor.Kind]; !ok {
+		return fmt.Errorf("save file has an Actor of unknown kind %q", actor.Kind)
+	}
+	switch actor.Kind {
+	case "rock":
+		if actor.Generation < 1 || actor.Generation > len(rockScales) {
+			return fmt.Errorf("save file has a rock of unknown generation %v", actor.Generation)
+		}
+		if len(actor.Outline) < 3 {
+			return fmt.Errorf("save file has a rock with a %v-point outline", len(actor.Outline))
+		}
+	case "ship":
+		if actor.Player < 1 || actor.Player > players {
+			return fmt.Errorf("save file has a ship for unknown player %v", actor.Player)
+		}
+		if actor.Weapon != nil && !knownWeapon(actor.Weapon.Name) {
+			return fmt.Errorf("save file has a ship with unknown weapon %q", actor.Weapon.Name)
+		}
+	}
+	return nil
+}
+
+// load replaces the game in play with a saved one.
+func (g *Game) load(file SaveFile) error {
+	if file.Version > saveVersion {
+		return fmt.Errorf("save file version %v is newer than this game's %v", file.Version, saveVersion)
+	}
+	save := file.Game
+	if save.Player < 1 || save.Player > len(save.Players) {
+		return fmt.Errorf("save file has no player %v", save.Player)
+	}
+	for _, actor := range file.Actors {
+		if err := checkActorSave(actor, len(save.Players)); err != nil {
+			return err
+		}
+	}
+	for _, player := range save.Players {
+		for _, rock := range player.Rocks {
+			if rock.Kind != "rock" {
+				return fmt.Errorf("save file has a %q among player %v's rocks", rock.Kind, player.Number)
+			}
+			if err := checkActorSave(rock, len(save.Players)); err != nil {
+				return err
+			}
+		}
+	}
+
+	g.stage.Reset()
+	g.audio.StopAll()
+	g.state = PlayingState
+	g.numberOfPlayers = len(save.Players)
+	g.coop = save.Coop
+	g.players = nil
+	for _, p := range save.Players {
+		player := makePlayer(g, len(g.players)+1)
+		player.score, player.lives, player.level = p.Score, p.Lives, p.Level
+		player.nextShipScore, player.shieldEnergy, player.respawning = p.NextShipScore, p.ShieldEnergy, p.Respawning
+		g.players = append(g.players, player)
+	}
+	g.player = g.players[save.Player-1]
+	g.setLevel(g.player.level)
+	g.makeHUD()
+
+	actors := make(map[int]Actor)
+	var loaded []Actor
+	var saves []*ActorSave
+	loadActor := func(actorSave *ActorSave) Actor {
+		actor := actorSavers[actorSave.Kind].load(g, actorSave)
+		if actor == nil {
+			return nil
+		}
+		base := actor.(interface{ baseActor() *BaseActor }).baseActor()
+		base.position, base.rotation, base.scale = actorSave.Position, actorSave.Rotation, actorSave.Scale
+		base.velocity, base.rotationVelocity = actorSave.Velocity, actorSave.RotationVelocity
+		actors[actorSave.ID] = actor
+		loaded = append(loaded, actor)
+		saves = append(saves, actorSave)
+		return actor
+	}
+	for i := range file.Actors {
+		loadActor(&file.Actors[i])
+	}
+	for i, p := range save.Players {
+		player := g.players[i]
+		if ship, ok := actors[p.Ship].(*Ship); ok && p.Ship != 0 {
+			player.ship = ship
+		}
+		for j := range p.Rocks {
+			if rock, ok := loadActor(&p.Rocks[j]).(*Rock); ok {
+				g.stage.RemoveActor(rock)
+				player.rocks = append(player.rocks, rock)
+			}
+		}
+	}
+	for i, actor := range loaded {
+		if link := actorSavers[saves[i].Kind].link; link != nil {
+			link(actor, saves[i], actors)
+		}
+	}
+
+	// The banners of an intermission or a new turn are taken down when it ends.
+	g.intermission = save.Intermission
+	g.waveBanner = nil
+	if g.intermission > 0 {
+		g.waveBanner = makeWaveBanner(g)
+	}
+	g.turnTimer = save.TurnTimer
+	g.turnBanner = nil
+	if g.turnTimer > 0 {
+		g.turnBanner = makeTurnBanner(g, fmt.Sprintf("PLAYER %v", g.player.number))
+	}
+	return nil
+}
+
+// writeSaveFile writes the SaveFile to path, as JSON if it ends in ".json" and in binary otherwise.
+func writeSaveFile(path string, file SaveFile) error {
+	var buf bytes.Buffer
+	if filepath.Ext(path) == ".json" {
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file); err != nil {
+			return err
+		}
+	} else {
+		buf.WriteString(saveMagic)
+		if err := gob.NewEncoder(&buf).Encode(file); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// readSaveFile reads a SaveFile in either format.
+func readSaveFile(path string) (SaveFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return SaveFile{}, err
+	}
+	defer f.Close()
+	return decodeSaveFile(bufio.NewReader(f))
+}
+
+func decodeSaveFile(r *bufio.Reader) (SaveFile, error) {
+	var file SaveFile
+	magic, err := r.Peek(len(saveMagic))
+	if err == nil && string(magic) == saveMagic {
+		r.Discard(len(saveMagic))
+		err = gob.NewDecoder(r).Decode(&file)
+	} else {
+		err = json.NewDecoder(r).Decode(&file)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return SaveFile{}, fmt.Errorf("reading save file: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeMidGame returns a two-player game well into player 2's first turn: player 1's rocks are stashed
+// and player 2's shielded ship is thrusting with its shots in flight.
+func makeMidGame(t *testing.T) *Game {
+	t.Helper()
+	rand.Seed(1)
+	game := makeHeadlessGame(t)
+	game.startGame(PlayingState, 2, false)
+	playing := func() bool {
+		return game.player.hasShip() && game.intermission <= 0 && game.stage.FindActorsByKind("rock") != nil
+	}
+	for i := 0; i < 600 && !playing(); i++ {
+		game.step(benchmarkDt)
+	}
+	// Losing the ship ends player 1's turn.
+	game.stage.RemoveActor(game.player.ship)
+	for i := 0; i < 600 && !playing(); i++ {
+		game.step(benchmarkDt)
+	}
+	if !playing() || len(game.players[0].rocks) == 0 {
+		t.Fatalf("player %v isn't playing with player 1's %v rocks stashed", game.player.number, len(game.players[0].rocks))
+	}
+
+	ship := game.player.ship
+	ship.controller = &actionsController{actions: Thrust | Fire}
+	ship.powerUps["shield"] = 5
+	for i := 0; i < 3; i++ {
+		game.step(benchmarkDt)
+	}
+	if gun, ok := ship.weapon.(*Gun); !ok || len(gun.live) == 0 || !ship.thrusting || !ship.shielded {
+		t.Fatalf("ship not firing, thrusting and shielded: %#v", ship)
+	}
+	return game
+}
+
+// renumberSave renumbers the Actors on the Stage in a SaveFile 1, 2, 3... in order, so saves of the same
+// game on different Stages compare equal.
+func renumberSave(file SaveFile) SaveFile {
+	ids := map[int]int{0: 0}
+	for i, actor := range file.Actors {
+		ids[actor.ID] = i + 1
+	}
+	id := func(old int) int {
+		if old < 0 {
+			return old // Stashed, numbered by the save.
+		}
+		return ids[old]
+	}
+	renumber := func(actor ActorSave) ActorSave {
+		actor.ID, actor.Shooter = id(actor.ID), id(actor.Shooter)
+		actor.Ignore = append([]int(nil), actor.Ignore...)
+		for i := range actor.Ignore {
+			actor.Ignore[i] = id(actor.Ignore[i])
+		}
+		if actor.Weapon != nil {
+			weapon := *actor.Weapon
+			weapon.Live = append([]int(nil), weapon.Live...)
+			for i := range weapon.Live {
+				weapon.Live[i] = id(weapon.Live[i])
+			}
+			actor.Weapon = &weapon
+		}
+		return actor
+	}
+
+	renumbered := file
+	renumbered.Actors = nil
+	for _, actor := range file.Actors {
+		renumbered.Actors = append(renumbered.Actors, renumber(actor))
+	}
+	renumbered.Game.Players = nil
+	for _, player := range file.Game.Players {
+		player.Ship = id(player.Ship)
+		rocks := player.Rocks
+		player.Rocks = nil
+		for _, rock := range rocks {
+			player.Rocks = append(player.Rocks, renumber(rock))
+		}
+		renumbered.Game.Players = append(renumbered.Game.Players, player)
+	}
+	return renumbered
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "savegame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	game := makeMidGame(t)
+	saved := game.save()
+	want := renumberSave(saved)
+	var stashed, shots, live int
+	for _, player := range saved.Game.Players {
+		stashed += len(player.Rocks)
+	}
+	for _, actor := range saved.Actors {
+		if actor.Kind == "shot" {
+			shots++
+		}
+		if actor.Weapon != nil {
+			live += len(actor.Weapon.Live)
+		}
+	}
+	if stashed == 0 || shots == 0 || live == 0 {
+		t.Fatalf("saved %v stashed rocks, %v shots and %v live projectiles", stashed, shots, live)
+	}
+
+	for _, name := range []string{"game.json", "game.sav"} {
+		path := filepath.Join(dir, name)
+		if err := writeSaveFile(path, saved); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isBinary := bytes.HasPrefix(data, []byte(saveMagic)); isBinary != (filepath.Ext(name) == ".sav") {
+			t.Errorf("%v: binary %v", name, isBinary)
+		}
+
+		file, err := readSaveFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded := makeHeadlessGame(t)
+		loaded.audio.LoadSounds()
+		if err := loaded.load(file); err != nil {
+			t.Fatal(err)
+		}
+		if got := renumberSave(loaded.save()); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: the loaded game saves differently:\n%v", name, diffSaves(got, want))
+		}
+		if loaded.audio.loops["thrust"] == nil {
+			t.Errorf("%v: the loaded ship's thrust is silent", name)
+		}
+	}
+}
+
+func TestLoadBadSave(t *testing.T) {
+	game := makeMidGame(t)
+	tests := []struct {
+		name  string
+		spoil func(file *SaveFile)
+	}{
+		{"no player", func(file *SaveFile) { file.Game.Player = 3 }},
+		{"unknown kind", func(file *SaveFile) { file.Actors[0].Kind = "saucer" }},
+		{"rock generation", func(file *SaveFile) { rock(file).Generation = 4 }},
+		{"rock outline", func(file *SaveFile) { rock(file).Outline = rock(file).Outline[:2] }},
+		{"stashed rock outline", func(file *SaveFile) { file.Game.Players[0].Rocks[0].Outline = nil }},
+		{"stashed ship", func(file *SaveFile) { file.Game.Players[0].Rocks[0].Kind = "ship" }},
+		{"ship player", func(file *SaveFile) { ship(file).Player = 3 }},
+		{"ship weapon", func(file *SaveFile) { ship(file).Weapon.Name = "phaser" }},
+	}
+	for _, test := range tests {
+		file := game.save()
+		test.spoil(&file)
+		if err := makeHeadlessGame(t).load(file); err == nil {
+			t.Errorf("%v: loaded", test.name)
+		}
+	}
+}
+
+// rock returns the first Rock on the Stage in the SaveFile.
+func rock(file *SaveFile) *ActorSave {
+	return firstActor(file, "rock")
+}
+
+// ship returns the first Ship on the Stage in the SaveFile.
+func ship(file *SaveFile) *ActorSave {
+	return firstActor(file, "ship")
+}
+
+func firstActor(file *SaveFile, kind string) *ActorSave {
+	for i := range file.Actors {
+		if file.Actors[i].Kind == kind {
+			return &file.Actors[i]
+		}
+	}
+	return nil
+}
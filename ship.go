@@ -0,0 +1,352 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"golang.org/x/image/colornames"
+)
+
+// shipFrame is the spritesheet frame the Ship is drawn with.
+const shipFrame = 8
+
+// FlightModel tunes how the Ship handles. Like all velocities, speeds are in pixels per frame.
+type FlightModel struct {
+	acceleration       float64 // Speed gained per second of thrust.
+	drag               float64 // Fraction of speed lost per second. 0 coasts forever.
+	maxSpeed           float64 // 0 for no limit.
+	rotateSpeed        float64 // Radians per second.
+	rotateAcceleration float64 // Radians per second per second. 0 turns at full rotateSpeed immediately.
+}
+
+var defaultFlightModel = FlightModel{acceleration: 10.0, drag: 0.4, maxSpeed: 8.0, rotateSpeed: 5.0}
+
+// ShipSpecial is the Ship's secondary action.
+type ShipSpecial int
+
+const (
+	HyperspaceSpecial ShipSpecial = iota // Jump to a random spot, at some risk.
+	ShieldSpecial                        // Deflect rocks while energy lasts.
+)
+
+// Ship is the hero. It handles the UI for the player ship.
+type Ship struct {
+	WrapAroundActor
+	game       *Game
+	player     *Player // Who flies it, and is credited with what it destroys.
+	controller Controller
+	flight     FlightModel
+	weapon     Weapon
+	thrusting  bool
+
+	specialHeld     bool    // So hyperspace requires a fresh press.
+	hyperspaceTimer float64 // While positive the Ship is in hyperspace: invisible and intangible.
+	shielded        bool
+	powerUps        map[string]float64 // Seconds left on each active timed PowerUp.
+	weaponPowerUp   string             // The PowerUp that granted the current Weapon, if any.
+	imd             *imdraw.IMDraw
+}
+
+func makeShip(game *Game, player *Player) *Ship {
+	stage := game.stage
+	s := Ship{
+		WrapAroundActor: makeWrapAroundActor(shipFrame, stage, "ship"),
+		player:          player,
+		controller:      game.shipController(player),
+		flight:          game.flightModel,
+		weapon:          makeWeapon(game.weapon),
+		powerUps:        make(map[string]float64),
+		imd:             imdraw.New(nil),
+		game:            game}
+	s.scale = 1.5
+
+	stage.AddActor(&s)
+	return &s
+}
+
+// Update responds to the Controller's Actions for moving and firing.
+// It also handles collision detection and response.
+func (s *Ship) Update(dt float64) {
+	stage := s.stage
+
+	if s.hyperspaceTimer > 0 {
+		s.hyperspaceTimer -= dt
+		if s.hyperspaceTimer <= 0 {
+			s.exitHyperspace()
+		}
+		return
+	}
+
+	s.weapon.Update(dt)
+	s.updatePowerUps(dt)
+
+	actions := s.controller.Actions(s)
+
+	thrusting := s.fly(actions, dt)
+	if thrusting != s.thrusting {
+		s.thrusting = thrusting
+		s.game.events.PublishShipThrust(ShipThrust{Ship: s, Thrusting: thrusting})
+	}
+
+	if actions.Has(Fire) {
+		s.weapon.Fire(s)
+	}
+	if s.weapon.Depleted() {
+		s.resetWeapon()
+	}
+
+	special := actions.Has(Special)
+	s.shielded = s.hasPowerUp("shield")
+	switch s.game.special {
+	case HyperspaceSpecial:
+		if special && !s.specialHeld {
+			s.enterHyperspace()
+		}
+	case ShieldSpecial:
+		s.updateShield(special, dt)
+	}
+	s.specialHeld = special
+	if s.hyperspaceTimer > 0 {
+		return
+	}
+
+	s.WrapAroundActor.Update(dt)
+
+	// Check for collision with a rock.
+	for _, actor := range stage.FindActorsByKind("rock") {
+		if intersects(s, actor) {
+			rock := actor.(*Rock)
+			if s.shielded {
+				s.deflect(rock)
+				continue
+			}
+
+			s.destroy(actor)
+			rock.subdivide(s)
+			break
+		}
+	}
+}
+
+// Draw the Ship, and its shield when raised. Nothing is drawn while in hyperspace.
+func (s *Ship) Draw() {
+	if s.hyperspaceTimer > 0 {
+		return
+	}
+	s.WrapAroundActor.Draw()
+
+	if s.shielded {
+		s.imd.Clear()
+		s.imd.Color = colornames.Deepskyblue
+		s.imd.Push(s.position)
+		s.imd.Circle(s.shieldRadius(), 2)
+		s.imd.Draw(s.stage.win)
+	}
+}
+
+// OnAdded gives the Ship its Flame. Wherever the Ship comes from, e.g. a save file, it gets one.
+func (s *Ship) OnAdded() {
+	makeFlame(s)
+}
+
+// Flame is the Ship's exhaust, shown while it thrusts. It is the Ship's child, so it is positioned
+// in the Ship's coordinates, turns with it, and goes when it does.
+type Flame struct {
+	BaseActor
+	ship    *Ship
+	flicker float64
+	imd     *imdraw.IMDraw
+}
+
+func makeFlame(ship *Ship) *Flame {
+	stage := ship.stage
+	f := Flame{BaseActor: MakeBaseActor(stage, "flame"), ship: ship, imd: imdraw.New(nil)}
+	f.position = pixel.V(0, -12) // Just behind the Ship's sprite.
+
+	stage.AddActor(&f)
+	stage.SetParent(&f, ship)
+	return &f
+}
+
+func (f *Flame) Bounds() pixel.Rect {
+	return pixel.R(-4, -8, 4, 0)
+}
+
+func (f *Flame) Update(dt float64) {
+	f.flicker += dt
+}
+
+// Draw a triangle of exhaust, flickering between two lengths.
+func (f *Flame) Draw() {
+	if !f.ship.thrusting || f.ship.hyperspaceTimer > 0 {
+		return
+	}
+	length := 8.0
+	if int(f.flicker*20)%2 == 1 {
+		length = 5
+	}
+
+	transform := f.Transform()
+	f.imd.Clear()
+	f.imd.Color = colornames.Orange
+	f.imd.Push(transform.Project(pixel.V(-4, 0)), transform.Project(pixel.V(4, 0)), transform.Project(pixel.V(0, -length)))
+	f.imd.Polygon(0)
+	f.imd.Draw(f.stage.win)
+}
+
+// resetWeapon switches back to the game's standard Weapon.
+func (s *Ship) resetWeapon() {
+	s.weapon = makeWeapon(s.game.weapon)
+	s.weaponPowerUp = ""
+}
+
+// destroy removes the Ship. by is whatever destroyed it, or nil if it destroyed itself.
+func (s *Ship) destroy(by Actor) {
+	s.stage.RemoveActor(s)
+
+	// TODO: explode ship
+	s.game.events.PublishShipDestroyed(ShipDestroyed{Ship: s, By: by})
+}
+
+// fly turns and thrusts as the Actions ask, then applies drag. It reports whether the Ship is thrusting.
+// It doesn't move the Ship, which WrapAroundActor.Update does.
+func (s *Ship) fly(actions Actions, dt float64) bool {
+	turn := 0.0
+	if actions.Has(TurnLeft) {
+		turn++
+	}
+	if actions.Has(TurnRight) {
+		turn--
+	}
+	s.turn(turn, dt)
+
+	thrusting := actions.Has(Thrust)
+	if thrusting {
+		s.thrust(dt)
+	}
+	s.applyDrag(dt)
+	return thrusting
+}
+
+func (s *Ship) thrust(dt float64) {
+	s.velocity = s.velocity.Add(pixel.Unit(s.rotation + math.Pi/2).Scaled(s.flight.acceleration * dt))
+	if s.flight.maxSpeed > 0 && s.velocity.Len() > s.flight.maxSpeed {
+		s.velocity = s.velocity.Unit().Scaled(s.flight.maxSpeed)
+	}
+}
+
+func (s *Ship) applyDrag(dt float64) {
+	s.velocity = s.velocity.Scaled(math.Max(0, 1-s.flight.drag*dt))
+}
+
+// turn rotates the Ship counter-clockwise for positive direction, clockwise for negative,
+// and brings it to a stop for zero.
+func (s *Ship) turn(direction float64, dt float64) {
+	flight := &s.flight
+	if flight.rotateAcceleration == 0 {
+		s.rotation += direction * flight.rotateSpeed * dt
+		return
+	}
+
+	// BaseActor.Update applies rotationVelocity.
+	if direction != 0 {
+		s.rotationVelocity += direction * flight.rotateAcceleration * dt
+		s.rotationVelocity = math.Max(-flight.rotateSpeed, math.Min(flight.rotateSpeed, s.rotationVelocity))
+	} else {
+		slowdown := math.Min(math.Abs(s.rotationVelocity), flight.rotateAcceleration*dt)
+		s.rotationVelocity -= math.Copysign(slowdown, s.rotationVelocity)
+	}
+}
+
+// enterHyperspace makes the Ship vanish. It reappears somewhere random when hyperspaceTimer runs out.
+func (s *Ship) enterHyperspace() {
+	s.hyperspaceTimer = s.game.hyperspaceDuration
+	if s.thrusting {
+		s.thrusting = false
+		s.game.events.PublishShipThrust(ShipThrust{Ship: s, Thrusting: false})
+	}
+}
+
+// exitHyperspace puts the Ship at a random position, stationary. Sometimes it doesn't survive the trip.
+func (s *Ship) exitHyperspace() {
+	bounds := s.stage.bounds
+	s.position = pixel.V(bounds.Min.X+rand.Float64()*bounds.W(), bounds.Min.Y+rand.Float64()*bounds.H())
+	s.velocity = pixel.ZV
+	s.rotationVelocity = 0
+
+	if rand.Float64() < s.game.hyperspaceFailure {
+		s.destroy(nil)
+	}
+}
+
+// updateShield raises the shield while requested and there is energy to power it. Energy recharges
+// while the shield isn't using it.
+func (s *Ship) updateShield(requested bool, dt float64) {
+	game := s.game
+	player := s.player
+	if requested && player.shieldEnergy > 0 {
+		s.shielded = true
+		player.shieldEnergy = math.Max(0, player.shieldEnergy-game.shieldDrain*dt)
+	} else {
+		player.shieldEnergy = math.Min(1, player.shieldEnergy+game.shieldRecharge*dt)
+	}
+}
+
+func (s *Ship) shieldRadius() float64 {
+	bounds := s.ScaledBounds()
+	return math.Max(bounds.W(), bounds.H()) * 0.75
+}
+
+// hit is called when a projectile strikes the Ship. It is destroyed unless its shield is up.
+func (s *Ship) hit(by Actor) {
+	if !s.shielded {
+		s.destroy(by)
+	}
+}
+
+// deflect bounces a Rock off the raised shield, nudging the Ship the other way.
+func (s *Ship) deflect(rock *Rock) {
+	away := rock.position.Sub(s.position).Unit()
+	if rock.velocity.Dot(away) < 0 {
+		rock.velocity = rock.velocity.Sub(away.Scaled(2 * rock.velocity.Dot(away)))
+	}
+	s.velocity = s.velocity.Sub(away.Scaled(0.5))
+}
+
+// ShieldMeter displays a player's remaining shield energy when shields are the Ship's special.
+type ShieldMeter struct {
+	BaseActor
+	game   *Game
+	player *Player
+	imd    *imdraw.IMDraw
+}
+
+func makeShieldMeter(game *Game, player *Player) *ShieldMeter {
+	stage := game.stage
+	m := ShieldMeter{BaseActor: MakeBaseActor(stage, "shieldMeter"), game: game, player: player, imd: imdraw.New(nil)}
+	m.position = pixel.V(stage.bounds.Min.X+10, stage.bounds.Max.Y-50)
+	if len(game.players) > 1 {
+		m.position = pixel.V(game.hudColumn(player)-50, stage.bounds.Max.Y-85)
+	}
+
+	stage.AddActor(&m)
+	return &m
+}
+
+// Draw an outlined bar filled in proportion to the remaining energy.
+func (a *ShieldMeter) Draw() {
+	if a.game.special != ShieldSpecial {
+		return
+	}
+
+	const width, height = 100.0, 8.0
+	a.imd.Clear()
+	a.imd.Color = colornames.Deepskyblue
+	a.imd.Push(a.position, a.position.Add(pixel.V(width*a.player.shieldEnergy, height)))
+	a.imd.Rectangle(0)
+	a.imd.Push(a.position, a.position.Add(pixel.V(width, height)))
+	a.imd.Rectangle(1)
+	a.imd.Draw(a.stage.win)
+}
@@ -14,7 +14,7 @@ import (
 // Stage retains, updates, and draws Actors.
 type Stage struct {
 	win              *pixelgl.Window
-	actors           []Actor
+	actors           []Actor // In the order added. Removed Actors leave a nil until compacted away, see allActors.
 	bounds           pixel.Rect
 	spritesheet      pixel.Picture
 	spritesheetImage image.Image
@@ -23,98 +23,456 @@ type Stage struct {
 	textAtlas        *text.Atlas
 
 	drawActorBounds bool
-	actorIDs        map[Actor]int
+	slots           []actorSlot
+	freeSlots       []int
+	removed         int // How many nils there are in actors.
+	kinds           map[string]*actorIndex
+	tags            map[string]*actorIndex
 	nextActorID     int
+	world           *World
+
+	// During Update, Actors added aren't on the Stage's lists, and those removed aren't told, until
+	// the end of the phase (Actors, World, collisions), so no phase sees a half-made change.
+	updating   bool
+	spawning   []Actor
+	despawning []Actor
+}
+
+// ActorHandle refers to an Actor on a Stage: the slot the Stage keeps it in, and the slot's
+// generation, which changes each time the slot is reused, so the handle of a removed Actor never
+// refers to another. The zero ActorHandle refers to nothing.
+type ActorHandle struct {
+	slot       int
+	generation int
+}
+
+// actorSlot is where a Stage keeps an Actor. A free slot's actor is nil.
+type actorSlot struct {
+	actor      Actor
+	generation int
+	id         int // Unlike slots, IDs aren't reused.
+	order      int // The Actor's index in Stage.actors, or -1 until it is added at the end of the phase.
+	parent     ActorHandle
+	children   []ActorHandle
+}
+
+// actorIndex lists the Actors of a kind, or with a tag, in the order they were added. Removing an Actor only marks
+// the list stale, to be rebuilt next time it's wanted, so lists already handed out never change.
+type actorIndex struct {
+	handles []ActorHandle // Including any removed since the list was rebuilt.
+	actors  []Actor
+	stale   bool
 }
 
 // MakeStage creates and initializes a Stage object.
 func MakeStage(stage Stage) Stage {
 	s := stage
-	s.actorIDs = make(map[Actor]int)
+	s.kinds = make(map[string]*actorIndex)
+	s.tags = make(map[string]*actorIndex)
 	s.nextActorID = 1 // ActorID 0 is reserved (means "not on the actors list")
+	s.world = makeWorld()
 	s.imd = imdraw.New(nil)
 	s.textAtlas = text.NewAtlas(basicfont.Face7x13, text.ASCII)
 	return s
 }
 
-// Reset the Stage to its initial state. All Actors are removed.
+// Reset the Stage to its initial state. All Actors are removed, without being told, and their handles
+// no longer refer to anything.
 func (s *Stage) Reset() {
 	s.actors = make([]Actor, 0)
+	s.removed = 0
+	s.spawning = nil
+	s.despawning = nil
+	s.freeSlots = s.freeSlots[:0]
+	for i := len(s.slots) - 1; i >= 0; i-- {
+		s.slots[i] = actorSlot{generation: s.slots[i].generation}
+		s.freeSlots = append(s.freeSlots, i)
+	}
+	s.kinds = make(map[string]*actorIndex)
+	s.tags = make(map[string]*actorIndex)
+	s.world.reset()
 }
 
-// AddActor adds the specified Actor to the Stage.
-func (s *Stage) AddActor(actor Actor) {
-	if s.actorIDs[actor] != 0 {
+// AddActor adds the specified Actor to the Stage and returns its handle. During Update, the Actor is
+// only updated, drawn and found by kind from the end of the current phase.
+func (s *Stage) AddActor(actor Actor) ActorHandle {
+	if s.HasActor(actor) {
 		panic(fmt.Sprintf("Actor has already been added. %#v", actor))
 	}
-	s.actors = append(s.actors, actor)
-	s.actorIDs[actor] = s.nextActorID
+
+	var slot int
+	if n := len(s.freeSlots); n > 0 {
+		slot = s.freeSlots[n-1]
+		s.freeSlots = s.freeSlots[:n-1]
+	} else {
+		slot = len(s.slots)
+		s.slots = append(s.slots, actorSlot{})
+	}
+	s.slots[slot] = actorSlot{actor: actor, generation: s.slots[slot].generation + 1, id: s.nextActorID, order: -1}
 	s.nextActorID++
+
+	handle := ActorHandle{slot: slot, generation: s.slots[slot].generation}
+	*actor.actorHandle() = handle
+
+	if s.updating {
+		s.spawning = append(s.spawning, actor)
+	} else {
+		s.activate(actor)
+	}
+	return handle
 }
 
-// RemoveActor removes the specified Actor from the Stage.
+// activate puts an added Actor on the Stage's lists and tells it.
+func (s *Stage) activate(actor Actor) {
+	slot := &s.slots[actor.actorHandle().slot]
+	if slot.order >= 0 {
+		return // Added, removed and added again within the phase, so queued twice.
+	}
+	slot.order = len(s.actors)
+	s.actors = append(s.actors, actor)
+
+	indexActor(s.kinds, actor.Kind(), actor)
+	s.indexTags(actor, actor.Tags())
+
+	if listener, ok := actor.(AddListener); ok {
+		listener.OnAdded()
+	}
+}
+
+// indexTags adds an Actor on the Stage to the lists of Actors with the tags.
+func (s *Stage) indexTags(actor Actor, tags []string) {
+	if s.slots[actor.actorHandle().slot].order < 0 {
+		return // It will be indexed with all its tags once it has been added.
+	}
+	for _, tag := range tags {
+		indexActor(s.tags, tag, actor)
+	}
+}
+
+func indexActor(indexes map[string]*actorIndex, name string, actor Actor) {
+	index := indexes[name]
+	if index == nil {
+		index = &actorIndex{}
+		indexes[name] = index
+	}
+	index.handles = append(index.handles, *actor.actorHandle())
+	if !index.stale {
+		index.actors = append(index.actors, actor)
+	}
+}
+
+// RemoveActor removes the specified Actor from the Stage. Removing an EntityActor removes its entity.
+// The Actor is gone at once, but during Update it is only told at the end of the current phase.
 func (s *Stage) RemoveActor(actor Actor) {
-	actorID := s.actorIDs[actor]
-	if actorID == 0 {
+	if !s.HasActor(actor) {
 		panic(fmt.Sprintf("Actor not found. %#v", actor))
 	}
+	handle := *actor.actorHandle()
+	slot := &s.slots[handle.slot]
 
-	for i, actorT := range s.actors {
-		if s.actorIDs[actorT] == actorID {
-			delete(s.actorIDs, actor)
-			s.actors = append(s.actors[:i], s.actors[i+1:]...)
-			return
+	// Children go with their parent.
+	for _, child := range append([]ActorHandle(nil), slot.children...) {
+		if actor := s.Get(child); actor != nil {
+			s.RemoveActor(actor)
 		}
 	}
+	if s.Get(slot.parent) != nil {
+		s.detach(slot.parent, handle)
+	}
+
+	active := slot.order >= 0
+	if active {
+		s.actors[slot.order] = nil
+		s.removed++
+		s.kinds[actor.Kind()].stale = true
+		for _, tag := range actor.Tags() {
+			if index := s.tags[tag]; index != nil {
+				index.stale = true
+			}
+		}
+	}
+	*slot = actorSlot{generation: slot.generation}
+	s.freeSlots = append(s.freeSlots, handle.slot)
+	if a, ok := actor.(*EntityActor); ok {
+		s.world.removeEntity(a.entity)
+	}
+
+	// An Actor added and removed within a phase was never really on the Stage.
+	if !active {
+		return
+	}
+	if s.updating {
+		s.despawning = append(s.despawning, actor)
+		return
+	}
+	// Outside Update, e.g. on a NetClient's Stage, which is never updated, the nil is left for the
+	// next Update, Draw or query to compact away, so removing many Actors stays linear.
+	if listener, ok := actor.(RemoveListener); ok {
+		listener.OnRemoved()
+	}
 }
 
-// FindActorsByKind returns an array of all Actors matching the requested 'kind', or nil if none.
-func (s *Stage) FindActorsByKind(kind string) []Actor {
-	actors := make([]Actor, 0)
+// SetParent makes the child's position, rotation and scale relative to the parent's, so it moves with
+// it, and has it removed along with it. A nil parent makes the child independent again. Both must be
+// on the Stage.
+func (s *Stage) SetParent(child Actor, parent Actor) {
+	if !s.HasActor(child) {
+		panic(fmt.Sprintf("Actor not found. %#v", child))
+	}
+	if parent != nil && !s.HasActor(parent) {
+		panic(fmt.Sprintf("Parent not found. %#v", parent))
+	}
+	for ancestor := parent; ancestor != nil; ancestor = s.Parent(ancestor) {
+		if ancestor == child {
+			panic(fmt.Sprintf("Actor can't be its own ancestor. %#v", child))
+		}
+	}
+
+	handle := *child.actorHandle()
+	slot := &s.slots[handle.slot]
+	if s.Get(slot.parent) != nil {
+		s.detach(slot.parent, handle)
+	}
+	slot.parent = ActorHandle{}
+	if parent != nil {
+		slot.parent = *parent.actorHandle()
+		parentSlot := &s.slots[slot.parent.slot]
+		parentSlot.children = append(parentSlot.children, handle)
+	}
+}
+
+// detach drops the child from the parent's children.
+func (s *Stage) detach(parent ActorHandle, child ActorHandle) {
+	slot := &s.slots[parent.slot]
+	for i, handle := range slot.children {
+		if handle == child {
+			slot.children = append(slot.children[:i:i], slot.children[i+1:]...)
+			break
+		}
+	}
+}
+
+// Parent returns the Actor's parent, or nil if it has none.
+func (s *Stage) Parent(actor Actor) Actor {
+	if !s.HasActor(actor) {
+		return nil
+	}
+	return s.Get(s.slots[actor.actorHandle().slot].parent)
+}
+
+// worldTransform composes the Actor's own transform with its ancestors', giving its transform in
+// Stage coordinates.
+func (s *Stage) worldTransform(handle ActorHandle, local pixel.Matrix) pixel.Matrix {
+	if s == nil || s.Get(handle) == nil {
+		return local
+	}
+	if parent := s.Get(s.slots[handle.slot].parent); parent != nil {
+		return local.Chained(parent.Transform())
+	}
+	return local
+}
+
+// WorldPosition returns where the Actor is in Stage coordinates. Its Position is relative to its
+// parent, if it has one.
+func (s *Stage) WorldPosition(actor Actor) pixel.Vec {
+	if s.Parent(actor) == nil {
+		return actor.Position()
+	}
+	return actor.Transform().Project(pixel.ZV)
+}
+
+// flush makes the additions and removals queued during a phase of Update, including any made by the
+// Actors told of them.
+func (s *Stage) flush() {
+	for len(s.spawning) > 0 || len(s.despawning) > 0 {
+		spawning, despawning := s.spawning, s.despawning
+		s.spawning, s.despawning = nil, nil
+		for _, actor := range spawning {
+			if s.HasActor(actor) {
+				s.activate(actor)
+			}
+		}
+		for _, actor := range despawning {
+			if s.HasActor(actor) {
+				continue // Added back since. Only Actors that stay gone are told.
+			}
+			if listener, ok := actor.(RemoveListener); ok {
+				listener.OnRemoved()
+			}
+		}
+	}
+}
+
+// compact drops the nils removed Actors left in actors, into a new list, as the old one may be being
+// iterated over, e.g. by a QueryIterator. The stale indexes drop their removed Actors' handles too,
+// even those of kinds and tags nobody asks for.
+func (s *Stage) compact() {
+	if s.removed == 0 {
+		return
+	}
+	actors := make([]Actor, 0, len(s.actors)-s.removed)
 	for _, actor := range s.actors {
-		if actor.Kind() == kind {
+		if actor != nil {
+			s.slots[actor.actorHandle().slot].order = len(actors)
 			actors = append(actors, actor)
 		}
 	}
-	if len(actors) == 0 {
+	s.actors = actors
+	s.removed = 0
+
+	s.pruneIndexes(s.kinds)
+	s.pruneIndexes(s.tags)
+}
+
+// pruneIndexes drops the handles of removed Actors from stale indexes. Their lists are still rebuilt
+// when next wanted.
+func (s *Stage) pruneIndexes(indexes map[string]*actorIndex) {
+	for _, index := range indexes {
+		if !index.stale {
+			continue
+		}
+		handles := index.handles[:0]
+		for _, handle := range index.handles {
+			if s.Get(handle) != nil {
+				handles = append(handles, handle)
+			}
+		}
+		index.handles = handles
+	}
+}
+
+// allActors returns the Actors on the Stage in the order they were added, first compacting away any
+// removed since the last Update. During Update the list may still hold nils.
+func (s *Stage) allActors() []Actor {
+	if !s.updating {
+		s.compact()
+	}
+	return s.actors
+}
+
+// Get returns the Actor the handle refers to, or nil if it has been removed.
+func (s *Stage) Get(handle ActorHandle) Actor {
+	if handle.slot < 0 || handle.slot >= len(s.slots) || s.slots[handle.slot].generation != handle.generation {
 		return nil
 	}
-	return actors
+	return s.slots[handle.slot].actor
 }
 
-// Update all Actors.
+// Handle returns the Actor's handle, or the zero ActorHandle if it isn't on the Stage.
+func (s *Stage) Handle(actor Actor) ActorHandle {
+	if !s.HasActor(actor) {
+		return ActorHandle{}
+	}
+	return *actor.actorHandle()
+}
+
+// ActorID returns the Actor's ID, unique for as long as the Stage exists, or 0 if it isn't on the Stage.
+func (s *Stage) ActorID(actor Actor) int {
+	if !s.HasActor(actor) {
+		return 0
+	}
+	return s.slots[actor.actorHandle().slot].id
+}
+
+// HasActor reports whether the Actor is on the Stage.
+func (s *Stage) HasActor(actor Actor) bool {
+	return s.Get(*actor.actorHandle()) == actor
+}
+
+// FindActorsByKind returns the Actors matching the requested 'kind', in the order they were added, or
+// nil if none. The slice belongs to the Stage and mustn't be modified, but Actors added and removed
+// later don't change it.
+func (s *Stage) FindActorsByKind(kind string) []Actor {
+	return s.indexed(s.kinds[kind])
+}
+
+// FindActorsByTag returns the Actors with the tag, like FindActorsByKind.
+func (s *Stage) FindActorsByTag(tag string) []Actor {
+	return s.indexed(s.tags[tag])
+}
+
+func (s *Stage) indexed(index *actorIndex) []Actor {
+	if index == nil {
+		return nil
+	}
+	if index.stale {
+		handles := index.handles[:0]
+		index.actors = make([]Actor, 0, len(index.handles))
+		for _, handle := range index.handles {
+			if actor := s.Get(handle); actor != nil {
+				handles = append(handles, handle)
+				index.actors = append(index.actors, actor)
+			}
+		}
+		index.handles = handles
+		index.stale = false
+	}
+	if len(index.actors) == 0 {
+		return nil
+	}
+	return index.actors
+}
+
+// Update all Actors, then the World's entities, then tell the Actors that collide.
 func (s *Stage) Update(dt float64) {
-	// Make a copy to protect from Update mutations.
-	actors := make([]Actor, len(s.actors))
-	copy(actors, s.actors)
-	for _, actor := range actors {
-		if s.actorIDs[actor] != 0 {
+	s.updating = true
+	for _, actor := range s.actors {
+		if actor != nil && s.HasActor(actor) {
 			actor.Update(dt)
 		}
 	}
+	s.flush()
+
+	s.world.update(s, dt)
+	s.flush()
+
+	s.collide()
+	s.flush()
+	s.updating = false
+
+	s.compact()
 }
 
-// Draw all Actors.
+// collide calls OnCollide on each CollisionListener for each other Actor it intersects.
+func (s *Stage) collide() {
+	for _, actor := range s.actors {
+		listener, ok := actor.(CollisionListener)
+		if !ok {
+			continue
+		}
+		for _, other := range s.actors {
+			if other != nil && s.HasActor(actor) && s.HasActor(other) && intersects(actor, other) {
+				listener.OnCollide(other)
+			}
+		}
+	}
+}
+
+// Draw all Actors. Nothing is drawn on a headless Stage, i.e. one without a window.
 func (s *Stage) Draw() {
+	if s.win == nil {
+		return
+	}
+	s.compact()
+
 	// Draw all the Actors.
-	// Make a copy to protect from Draw mutations (that be would be dumb, but just in case).
-	actors := make([]Actor, len(s.actors))
-	copy(actors, s.actors)
+	actors := s.actors
 	for _, actor := range actors {
-		if s.actorIDs[actor] != 0 {
+		if actor != nil && s.HasActor(actor) {
 			actor.Draw()
 		}
 	}
+	s.world.draw(s)
 
 	s.imd.Clear()
 
-	// Draw bounding boxes of all actors.
+	// Draw the collision polygons of all actors, where they are on the Stage, children included.
 	if s.drawActorBounds {
 		for _, actor := range s.actors {
-			polygon := polygonFromRect(actor.Bounds())
-			transform := actor.Transform()
-			polygon = projectPolygon(&polygon, &transform)
-			for _, v := range polygon {
+			if actor == nil {
+				continue
+			}
+			for _, v := range collisionPolygon(actor) {
 				s.imd.Push(v)
 			}
 			s.imd.Polygon(1)
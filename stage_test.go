@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// listenerActor counts how often it is told it was added and removed.
+type listenerActor struct {
+	boxActor
+	added, removed int
+}
+
+func (a *listenerActor) OnAdded()   { a.added++ }
+func (a *listenerActor) OnRemoved() { a.removed++ }
+
+// scriptActor runs a function when updated.
+type scriptActor struct {
+	BaseActor
+	update func()
+}
+
+func (a *scriptActor) Update(dt float64) {
+	a.update()
+}
+
+func TestStageChurnWithinUpdate(t *testing.T) {
+	stage := makeTestStage()
+	churned := &listenerActor{boxActor: boxActor{BaseActor: MakeBaseActor(stage, "rock")}}
+	returning := &listenerActor{boxActor: boxActor{BaseActor: MakeBaseActor(stage, "rock")}}
+	stage.AddActor(returning)
+	script := &scriptActor{BaseActor: MakeBaseActor(stage, "script"), update: func() {
+		stage.AddActor(churned)
+		stage.RemoveActor(churned)
+		stage.AddActor(churned)
+
+		stage.RemoveActor(returning)
+		stage.AddActor(returning)
+	}}
+	stage.AddActor(script)
+	stage.Update(1.0 / 60)
+
+	if churned.added != 1 || churned.removed != 0 {
+		t.Errorf("the Actor added, removed and added again was told it was added %v times and removed %v",
+			churned.added, churned.removed)
+	}
+	if returning.added != 2 || returning.removed != 0 {
+		t.Errorf("the Actor removed and added back was told it was added %v times and removed %v",
+			returning.added, returning.removed)
+	}
+	if rocks := stage.FindActorsByKind("rock"); len(rocks) != 2 {
+		t.Errorf("%v rocks, want 2", len(rocks))
+	}
+	if len(stage.actors) != 3 {
+		t.Errorf("%v Actors, want 3", len(stage.actors))
+	}
+}
+
+func TestStageRemoveOutsideUpdate(t *testing.T) {
+	stage := makeTestStage()
+	var boxes []*boxActor
+	for i := 0; i < 10; i++ {
+		boxes = append(boxes, addBox(stage, "rock", pixel.V(float64(i*10), 0), 1))
+	}
+	for _, box := range boxes[:5] {
+		stage.RemoveActor(box)
+	}
+	// Compacting waits until the Actors are wanted.
+	if stage.removed != 5 || len(stage.actors) != 10 {
+		t.Errorf("%v Actors, %v of them removed", len(stage.actors), stage.removed)
+	}
+
+	hits := stage.OverlapCircle(pixel.ZV, 1000)
+	if len(hits) != 5 || hits[0] != boxes[5] {
+		t.Errorf("%v Actors found", len(hits))
+	}
+	if stage.removed != 0 || len(stage.actors) != 5 {
+		t.Errorf("%v Actors, %v of them removed, after a query", len(stage.actors), stage.removed)
+	}
+	for i, box := range boxes[5:] {
+		if order := stage.slots[box.handle.slot].order; order != i {
+			t.Errorf("Actor %v is at %v, want %v", i+5, order, i)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// stateHash returns a hash of the game's state: the SaveFile with the Actors ordered by ID. It is
+// the same on any machine for the same state, so runs that should be identical, e.g. a replay or
+// lockstep peers, can be checked cheaply.
+//
+// It only covers what is saved. Game.state and levelParams aren't, nor are the World's entities,
+// such as a Rock's debris, so runs differing only in those hash the same.
+func (g *Game) stateHash() uint64 {
+	return hashState(g.save())
+}
+
+func hashState(file SaveFile) uint64 {
+	file.Actors = actorsByID(file.Actors)
+
+	// encoding/json sorts map keys and writes floats exactly, so the encoding is canonical.
+	h := fnv.New64a()
+	if err := json.NewEncoder(h).Encode(file); err != nil {
+		panic(err)
+	}
+	return h.Sum64()
+}
+
+// actorsByID returns a copy of the ActorSaves sorted by ID.
+func actorsByID(actors []ActorSave) []ActorSave {
+	sorted := append([]ActorSave(nil), actors...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
+
+// StateLog records a Game's state hash every tick, and its whole state every snapshotEvery ticks,
+// one JSON object per line. The logs of two runs can be compared with diffStateLogs.
+type StateLog struct {
+	file          *os.File
+	writer        *bufio.Writer
+	encoder       *json.Encoder
+	snapshotEvery int
+	tick          int
+}
+
+type stateLogEntry struct {
+	Tick  int       `json:"tick"`
+	Hash  string    `json:"hash"`
+	State *SaveFile `json:"state,omitempty"`
+}
+
+func openStateLog(path string, snapshotEvery int) (*StateLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	return &StateLog{file: file, writer: writer, encoder: json.NewEncoder(writer), snapshotEvery: snapshotEvery}, nil
+}
+
+// record logs the state after a tick.
+func (l *StateLog) record(g *Game) error {
+	state := g.save()
+	entry := stateLogEntry{Tick: l.tick, Hash: fmt.Sprintf("%016x", hashState(state))}
+	if l.snapshotEvery > 0 && l.tick%l.snapshotEvery == 0 {
+		entry.State = &state
+	}
+	l.tick++
+	return l.encoder.Encode(entry)
+}
+
+func (l *StateLog) Close() error {
+	if err := l.writer.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// readStateLog reads a StateLog's entries.
+func readStateLog(path string) ([]stateLogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []stateLogEntry
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var entry stateLogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// runDiff compares two StateLogs (".jsonl" files) or two save files and prints the differences.
+func runDiff(a string, b string) error {
+	if filepath.Ext(a) == ".jsonl" && filepath.Ext(b) == ".jsonl" {
+		return diffStateLogs(os.Stdout, a, b)
+	}
+	fileA, err := readSaveFile(a)
+	if err != nil {
+		return err
+	}
+	fileB, err := readSaveFile(b)
+	if err != nil {
+		return err
+	}
+	printDiff(os.Stdout, diffSaves(fileA, fileB))
+	return nil
+}
+
+// diffStateLogs reports the first tick where two runs' states differ, and what differs in the first
+// snapshot both logs have from then on, to out.
+func diffStateLogs(out io.Writer, a string, b string) error {
+	entriesA, err := readStateLog(a)
+	if err != nil {
+		return err
+	}
+	entriesB, err := readStateLog(b)
+	if err != nil {
+		return err
+	}
+
+	ticks := len(entriesA)
+	if len(entriesB) < ticks {
+		ticks = len(entriesB)
+	}
+	diverged := -1
+	for tick := 0; tick < ticks; tick++ {
+		if entriesA[tick].Hash != entriesB[tick].Hash {
+			diverged = tick
+			break
+		}
+	}
+	if diverged < 0 {
+		fmt.Fprintf(out, "No divergence in %v ticks.\n", ticks)
+		if len(entriesA) != len(entriesB) {
+			fmt.Fprintf(out, "The logs have %v and %v ticks.\n", len(entriesA), len(entriesB))
+		}
+		return nil
+	}
+	fmt.Fprintf(out, "Diverged at tick %v: hash %v vs %v.\n", diverged, entriesA[diverged].Hash, entriesB[diverged].Hash)
+
+	for tick := diverged; tick < ticks; tick++ {
+		if entriesA[tick].State != nil && entriesB[tick].State != nil {
+			fmt.Fprintf(out, "Differences at tick %v:\n", tick)
+			printDiff(out, diffSaves(*entriesA[tick].State, *entriesB[tick].State))
+			return nil
+		}
+	}
+	fmt.Fprintln(out, "Neither log has a snapshot from then on. Log snapshots more often to see the differences.")
+	return nil
+}
+
+func printDiff(out io.Writer, differences []string) {
+	if len(differences) == 0 {
+		fmt.Fprintln(out, "No differences.")
+	}
+	for _, difference := range differences {
+		fmt.Fprintln(out, difference)
+	}
+}
+
+// diffSaves describes how two saved states differ: the Game and Player fields that differ, the
+// Actors only in one of them, and for the Actors in both, by ID, the fields that differ.
+func diffSaves(a SaveFile, b SaveFile) []string {
+	var differences []string
+	if a.Version != b.Version {
+		differences = append(differences, fmt.Sprintf("version: %v vs %v", a.Version, b.Version))
+	}
+
+	gameA, gameB := a.Game, b.Game
+	gameA.Players, gameB.Players = nil, nil
+	differences = append(differences, diffFields("game", gameA, gameB)...)
+	for i := 0; i < len(a.Game.Players) || i < len(b.Game.Players); i++ {
+		name := fmt.Sprintf("player %v", i+1)
+		switch {
+		case i >= len(b.Game.Players):
+			differences = append(differences, fmt.Sprintf("%v: only in the first", name))
+		case i >= len(a.Game.Players):
+			differences = append(differences, fmt.Sprintf("%v: only in the second", name))
+		default:
+			playerA, playerB := a.Game.Players[i], b.Game.Players[i]
+			differences = append(differences, diffActors(name+" rock", playerA.Rocks, playerB.Rocks)...)
+			playerA.Rocks, playerB.Rocks = nil, nil
+			differences = append(differences, diffFields(name, playerA, playerB)...)
+		}
+	}
+
+	return append(differences, diffActors("", a.Actors, b.Actors)...)
+}
+
+// diffActors matches up Actors by ID and describes how they differ.
+func diffActors(prefix string, a []ActorSave, b []ActorSave) []string {
+	var differences []string
+	actorsA, actorsB := actorsByID(a), actorsByID(b)
+	for i, j := 0, 0; i < len(actorsA) || j < len(actorsB); {
+		switch {
+		case j >= len(actorsB) || (i < len(actorsA) && actorsA[i].ID < actorsB[j].ID):
+			differences = append(differences, fmt.Sprintf("%v: only in the first", actorName(prefix, actorsA[i])))
+			i++
+		case i >= len(actorsA) || actorsB[j].ID < actorsA[i].ID:
+			differences = append(differences, fmt.Sprintf("%v: only in the second", actorName(prefix, actorsB[j])))
+			j++
+		default:
+			differences = append(differences, diffFields(actorName(prefix, actorsA[i]), actorsA[i], actorsB[j])...)
+			i++
+			j++
+		}
+	}
+	return differences
+}
+
+func actorName(prefix string, actor ActorSave) string {
+	if prefix != "" {
+		return fmt.Sprintf("%v %v", prefix, actor.ID)
+	}
+	return fmt.Sprintf("%v %v", actor.Kind, actor.ID)
+}
+
+// diffFields describes each field that differs between two structs of the same type.
+func diffFields(name string, a interface{}, b interface{}) []string {
+	var differences []string
+	valueA, valueB := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < valueA.NumField(); i++ {
+		fieldA, fieldB := valueA.Field(i).Interface(), valueB.Field(i).Interface()
+		if !reflect.DeepEqual(fieldA, fieldB) {
+			differences = append(differences, fmt.Sprintf("%v: %v %v vs %v", name, valueA.Type().Field(i).Name,
+				describeField(fieldA), describeField(fieldB)))
+		}
+	}
+	return differences
+}
+
+// describeField formats a field's value, following pointers.
+func describeField(field interface{}) string {
+	value := reflect.ValueOf(field)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return "nil"
+		}
+		return fmt.Sprintf("%+v", value.Elem().Interface())
+	}
+	return fmt.Sprintf("%+v", field)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestStateLogOnTitle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "title.jsonl")
+
+	game := makeHeadlessGame(t)
+	game.attract = true
+	game.showTitle()
+	stateLog, err := openStateLog(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	game.stateLog = stateLog
+	for i := 0; i < 5; i++ {
+		game.update(benchmarkDt)
+	}
+	if game.stateLog == nil {
+		t.Fatal("stopped logging the state")
+	}
+	if err := stateLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readStateLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("got %v entries, want 5", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Tick != i {
+			t.Errorf("entry %v has tick %v", i, entry.Tick)
+		}
+		if hasState := entry.State != nil; hasState != (i%2 == 0) {
+			t.Errorf("entry %v has state %v", i, hasState)
+		}
+	}
+	if rocks := len(entries[0].State.Actors); rocks == 0 {
+		t.Error("the title's rocks were not logged")
+	}
+}
+
+// makeDiffSaves returns two saves that differ in a player's score, a rock's position and a shot only in
+// the first.
+func makeDiffSaves() (SaveFile, SaveFile) {
+	a := SaveFile{Version: saveVersion, Game: GameSave{Player: 1, Players: []PlayerSave{{Number: 1, Score: 100, Lives: 3}}},
+		Actors: []ActorSave{{ID: 1, Kind: "rock", Generation: 1}, {ID: 2, Kind: "ship", Player: 1}, {ID: 3, Kind: "shot"}}}
+	b := a
+	b.Game.Players = []PlayerSave{a.Game.Players[0]}
+	b.Game.Players[0].Score = 150
+	b.Actors = []ActorSave{a.Actors[0], a.Actors[1]}
+	b.Actors[0].Position = pixel.V(5, 0)
+	return a, b
+}
+
+func TestDiffSaves(t *testing.T) {
+	a, b := makeDiffSaves()
+	want := []string{
+		"player 1: Score 100 vs 150",
+		"rock 1: Position Vec(0, 0) vs Vec(5, 0)",
+		"shot 3: only in the first",
+	}
+	if got := diffSaves(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := diffSaves(a, a); len(got) != 0 {
+		t.Errorf("a save differs from itself: %q", got)
+	}
+
+	// The hash depends on the Actors, not the order they were added in.
+	reversed := a
+	reversed.Actors = nil
+	for i := len(a.Actors) - 1; i >= 0; i-- {
+		reversed.Actors = append(reversed.Actors, a.Actors[i])
+	}
+	if hashState(reversed) != hashState(a) {
+		t.Error("reordering the Actors changed the hash")
+	}
+	if hashState(a) == hashState(b) {
+		t.Error("different saves hash the same")
+	}
+}
+
+func TestDiffStateLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := makeDiffSaves()
+	hashA, hashB := fmt.Sprintf("%016x", hashState(a)), fmt.Sprintf("%016x", hashState(b))
+	// writeLog writes a log of ticks ticks, the states from the tick diverge on being the second save's.
+	writeLog := func(name string, ticks int, diverge int, snapshots bool) string {
+		path := filepath.Join(dir, name)
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		for tick := 0; tick < ticks; tick++ {
+			entry := stateLogEntry{Tick: tick, Hash: hashA}
+			state := a
+			if diverge >= 0 && tick >= diverge {
+				entry.Hash, state = hashB, b
+			}
+			if snapshots && tick%2 == 0 {
+				entry.State = &state
+			}
+			if err := encoder.Encode(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	same := writeLog("same.jsonl", 4, -1, true)
+	tests := []struct {
+		name string
+		b    string
+		want string
+	}{
+		{"same", writeLog("same2.jsonl", 4, -1, true), "No divergence in 4 ticks.\n"},
+		{"longer", writeLog("longer.jsonl", 6, -1, true), "No divergence in 4 ticks.\nThe logs have 4 and 6 ticks.\n"},
+		{"diverged", writeLog("diverged.jsonl", 4, 1, true), fmt.Sprintf("Diverged at tick 1: hash %v vs %v.\n"+
+			"Differences at tick 2:\nplayer 1: Score 100 vs 150\nrock 1: Position Vec(0, 0) vs Vec(5, 0)\nshot 3: only in the first\n",
+			hashA, hashB)},
+		{"no snapshots", writeLog("unsnapped.jsonl", 4, 3, false), fmt.Sprintf("Diverged at tick 3: hash %v vs %v.\n"+
+			"Neither log has a snapshot from then on. Log snapshots more often to see the differences.\n", hashA, hashB)},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := diffStateLogs(&out, same, test.b); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.want {
+			t.Errorf("%v: got\n%v\nwant\n%v", test.name, out.String(), test.want)
+		}
+	}
+}
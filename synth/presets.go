@@ -0,0 +1,50 @@
+package synth
+
+// The classic arcade sounds. Copy and tweak them to make variations.
+var (
+	// Laser is a short, bright zap that sweeps down.
+	Laser = Params{Waveform: Square, Sustain: 0.05, Decay: 0.12, Punch: 0.3,
+		Frequency: 1400, FrequencySlide: -7000, MinFrequency: 200, DutyCycle: 0.3, DutySweep: 1.5, Volume: 0.35}
+
+	ExplosionLarge = Params{Waveform: Noise, Attack: 0.005, Sustain: 0.15, Decay: 0.75, Punch: 0.5,
+		Frequency: 1800, FrequencySlide: -1400, MinFrequency: 300, LowPass: 0.6, Volume: 0.65, Seed: 1}
+	ExplosionMedium = Params{Waveform: Noise, Attack: 0.005, Sustain: 0.1, Decay: 0.5, Punch: 0.5,
+		Frequency: 2600, FrequencySlide: -2200, MinFrequency: 500, LowPass: 0.45, Volume: 0.6, Seed: 2}
+	ExplosionSmall = Params{Waveform: Noise, Attack: 0.005, Sustain: 0.06, Decay: 0.3, Punch: 0.5,
+		Frequency: 4000, FrequencySlide: -4000, MinFrequency: 800, LowPass: 0.3, Volume: 0.55, Seed: 3}
+
+	// ThumpLow and ThumpHigh alternate to make the heartbeat.
+	ThumpLow = Params{Waveform: Square, Attack: 0.005, Sustain: 0.04, Decay: 0.08,
+		Frequency: 55, DutyCycle: 0.5, LowPass: 0.7, Volume: 0.9}
+	ThumpHigh = Params{Waveform: Square, Attack: 0.005, Sustain: 0.04, Decay: 0.08,
+		Frequency: 62, DutyCycle: 0.5, LowPass: 0.7, Volume: 0.9}
+
+	// Thrust is a low rumble meant to be looped.
+	Thrust = Params{Waveform: Noise, Sustain: 1, Frequency: 600, LowPass: 0.85, Volume: 0.5, Seed: 4}
+
+	// SaucerSiren warbles between two pitches and is meant to be looped.
+	SaucerSiren = Params{Waveform: Square, Sustain: 0.5, Frequency: 900, VibratoDepth: 0.15, VibratoSpeed: 4,
+		DutyCycle: 0.5, LowPass: 0.2, Volume: 0.25}
+
+	// ExtraLife is a rising two-note chime.
+	ExtraLife = Params{Waveform: Triangle, Sustain: 0.25, Decay: 0.35,
+		Frequency: 880, ChangeTime: 0.12, ChangeAmount: 1.5, Volume: 0.5}
+
+	// PowerUp is a quick upward sweep.
+	PowerUp = Params{Waveform: Square, Sustain: 0.08, Decay: 0.15,
+		Frequency: 400, FrequencySlide: 3000, DutyCycle: 0.5, LowPass: 0.3, Volume: 0.3}
+)
+
+// Presets maps names to the predefined sounds.
+var Presets = map[string]Params{
+	"laser":           Laser,
+	"explosionLarge":  ExplosionLarge,
+	"explosionMedium": ExplosionMedium,
+	"explosionSmall":  ExplosionSmall,
+	"thumpLow":        ThumpLow,
+	"thumpHigh":       ThumpHigh,
+	"thrust":          Thrust,
+	"saucerSiren":     SaucerSiren,
+	"extraLife":       ExtraLife,
+	"powerUp":         PowerUp,
+}
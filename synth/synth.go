@@ -0,0 +1,118 @@
+// Package synth generates retro sound effects from a handful of parameters, in the spirit of sfxr.
+// Output is mono PCM as float64 samples in the range -1..1.
+package synth
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Waveform selects the oscillator a sound is built from.
+type Waveform int
+
+const (
+	Square Waveform = iota
+	Sawtooth
+	Sine
+	Triangle
+	Noise
+)
+
+// Params describes a sound effect. Times are in seconds, frequencies in Hz.
+type Params struct {
+	Waveform Waveform
+
+	// Envelope. The sound lasts Attack+Sustain+Decay seconds.
+	Attack  float64
+	Sustain float64
+	Decay   float64
+	Punch   float64 // Extra volume at the start of the sustain, fading to nothing by its end.
+
+	Frequency      float64 // For Noise this is how often a new random value is picked.
+	FrequencySlide float64 // Hz per second. Negative slides down.
+	MinFrequency   float64 // Sliding stops here.
+
+	VibratoDepth float64 // Fraction of the frequency to wobble by.
+	VibratoSpeed float64 // Wobbles per second.
+
+	ChangeTime   float64 // If non-zero, the frequency is multiplied by ChangeAmount this far in.
+	ChangeAmount float64
+
+	DutyCycle float64 // Square wave only. 0.5 is a plain square wave.
+	DutySweep float64 // Change in DutyCycle per second.
+
+	LowPass float64 // 0 (none) to 1 (very muffled).
+	Volume  float64
+	Seed    int64 // Seeds Noise so the same Params always produce the same samples.
+}
+
+// Duration returns the length of the sound in seconds.
+func (p *Params) Duration() float64 {
+	return p.Attack + p.Sustain + p.Decay
+}
+
+// Generate renders the sound at the given sample rate.
+func Generate(p Params, sampleRate int) []float64 {
+	rng := rand.New(rand.NewSource(p.Seed))
+	samples := make([]float64, int(p.Duration()*float64(sampleRate)))
+
+	phase := 0.0
+	noise := rng.Float64()*2 - 1
+	filtered := 0.0
+	filterCoefficient := 1 - p.LowPass*0.99
+
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+
+		frequency := p.Frequency + p.FrequencySlide*t
+		if frequency < p.MinFrequency {
+			frequency = p.MinFrequency
+		}
+		if p.ChangeTime > 0 && t >= p.ChangeTime {
+			frequency *= p.ChangeAmount
+		}
+		frequency *= 1 + p.VibratoDepth*math.Sin(2*math.Pi*p.VibratoSpeed*t)
+
+		phase += frequency / float64(sampleRate)
+		if phase >= 1 {
+			phase -= math.Floor(phase)
+			noise = rng.Float64()*2 - 1
+		}
+
+		var sample float64
+		switch p.Waveform {
+		case Square:
+			duty := math.Max(0.05, math.Min(0.95, p.DutyCycle+p.DutySweep*t))
+			sample = 1
+			if phase >= duty {
+				sample = -1
+			}
+		case Sawtooth:
+			sample = phase*2 - 1
+		case Sine:
+			sample = math.Sin(2 * math.Pi * phase)
+		case Triangle:
+			sample = 1 - 4*math.Abs(phase-0.5)
+		case Noise:
+			sample = noise
+		}
+
+		// Punch can take the envelope past 1, so clip to stay in range.
+		filtered += filterCoefficient * (sample - filtered)
+		samples[i] = math.Max(-1, math.Min(1, filtered*p.envelope(t)*p.Volume))
+	}
+	return samples
+}
+
+// envelope returns the volume multiplier at time t.
+func (p *Params) envelope(t float64) float64 {
+	switch {
+	case t < p.Attack:
+		return t / p.Attack
+	case t < p.Attack+p.Sustain:
+		return 1 + p.Punch*(1-(t-p.Attack)/p.Sustain)
+	case p.Decay > 0:
+		return math.Max(0, 1-(t-p.Attack-p.Sustain)/p.Decay)
+	}
+	return 0
+}
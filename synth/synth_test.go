@@ -0,0 +1,90 @@
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateLength(t *testing.T) {
+	p := Params{Waveform: Sine, Attack: 0.1, Sustain: 0.2, Decay: 0.2, Frequency: 440, Volume: 1}
+	for _, sampleRate := range []int{8000, 22050, 44100} {
+		if got, want := len(Generate(p, sampleRate)), int(0.5*float64(sampleRate)); got != want {
+			t.Errorf("%v Hz: got %v samples, want %v", sampleRate, got, want)
+		}
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	for name, p := range Presets {
+		if !reflect.DeepEqual(Generate(p, 22050), Generate(p, 22050)) {
+			t.Errorf("%v: the same Params gave different samples", name)
+		}
+	}
+}
+
+func TestGenerateRange(t *testing.T) {
+	// Punch takes the envelope past 1.
+	params := map[string]Params{
+		"punchy": {Waveform: Square, Sustain: 0.1, Decay: 0.1, Punch: 2, Frequency: 300, DutyCycle: 0.5, Volume: 1},
+	}
+	for name, p := range Presets {
+		params[name] = p
+	}
+	for name, p := range params {
+		for i, sample := range Generate(p, 22050) {
+			if sample < -1 || sample > 1 {
+				t.Errorf("%v: sample %v is %v", name, i, sample)
+				break
+			}
+		}
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	samples := []float64{0, 1, -1, 0.5}
+	var buf bytes.Buffer
+	if err := WriteWAV(&buf, samples, 22050); err != nil {
+		t.Fatal(err)
+	}
+
+	var header struct {
+		Riff          [4]byte
+		RiffSize      uint32
+		Wave          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}
+	r := bytes.NewReader(buf.Bytes())
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	want := header
+	want.Riff, want.Wave, want.Fmt, want.Data = [4]byte{'R', 'I', 'F', 'F'}, [4]byte{'W', 'A', 'V', 'E'}, [4]byte{'f', 'm', 't', ' '}, [4]byte{'d', 'a', 't', 'a'}
+	want.RiffSize, want.FmtSize, want.DataSize = 36+8, 16, 8
+	want.Format, want.Channels, want.SampleRate, want.ByteRate = 1, 1, 22050, 44100
+	want.BlockAlign, want.BitsPerSample = 2, 16
+	if header != want {
+		t.Errorf("got header %+v, want %+v", header, want)
+	}
+
+	data := make([]int16, len(samples))
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int16{0, 32767, -32767, 16383}; !reflect.DeepEqual(data, want) {
+		t.Errorf("got samples %v, want %v", data, want)
+	}
+	if r.Len() != 0 {
+		t.Errorf("%v bytes after the samples", r.Len())
+	}
+}
@@ -0,0 +1,54 @@
+package synth
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+)
+
+// WriteWAV encodes samples as a 16-bit mono PCM WAV file.
+func WriteWAV(w io.Writer, samples []float64, sampleRate int) error {
+	const bytesPerSample = 2
+	dataSize := len(samples) * bytesPerSample
+
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(36 + dataSize),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),                          // fmt chunk size
+		uint16(1),                           // PCM
+		uint16(1),                           // mono
+		uint32(sampleRate),                  // sample rate
+		uint32(sampleRate * bytesPerSample), // byte rate
+		uint16(bytesPerSample),              // block align
+		uint16(bytesPerSample * 8),          // bits per sample
+		[4]byte{'d', 'a', 't', 'a'},
+		uint32(dataSize),
+	}
+	for _, field := range header {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	data := make([]int16, len(samples))
+	for i, sample := range samples {
+		data[i] = int16(math.Max(-1, math.Min(1, sample)) * math.MaxInt16)
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+// WriteWAVFile renders p and saves it to path.
+func WriteWAVFile(path string, p Params, sampleRate int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteWAV(file, Generate(p, sampleRate), sampleRate); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
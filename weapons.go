@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"golang.org/x/image/colornames"
+)
+
+// Weapon is what the Ship fires with.
+type Weapon interface {
+	Name() string
+	// Update cools the Weapon down. It is called every frame, firing or not.
+	Update(dt float64)
+	// Fire is called every frame the trigger is held. The Weapon fires if it is ready.
+	Fire(ship *Ship)
+	// Depleted reports whether the Weapon has run out of ammo.
+	Depleted() bool
+	// Status is a short description for the HUD, e.g. remaining ammo. Empty for nothing to report.
+	Status() string
+}
+
+// Projectile is implemented by Actors a Ship fires, so what they hit can be credited to it.
+type Projectile interface {
+	Shooter() *Ship
+}
+
+// shooterOf returns the Ship responsible for the Actor: the Ship itself, or the one that fired it.
+// nil for anything else.
+func shooterOf(actor Actor) *Ship {
+	switch a := actor.(type) {
+	case *Ship:
+		return a
+	case Projectile:
+		return a.Shooter()
+	}
+	return nil
+}
+
+// friendlyFireTarget returns a Ship, other than the one that fired it, that the projectile has hit.
+// Always nil unless friendly fire is on.
+func friendlyFireTarget(game *Game, projectile Actor, shooter *Ship) *Ship {
+	if !game.friendlyFire {
+		return nil
+	}
+	for _, actor := range game.stage.FindActorsByKind("ship") {
+		ship := actor.(*Ship)
+		if ship != shooter && ship.hyperspaceTimer <= 0 && intersects(projectile, ship) {
+			return ship
+		}
+	}
+	return nil
+}
+
+// weaponTypes lists the available Weapons in the order the debug key cycles through them.
+var weaponTypes = []struct {
+	name string
+	make func() Weapon
+}{
+	{"single", makeSingleShot},
+	{"spread", makeSpreadShot},
+	{"laser", makeLaser},
+	{"missiles", makeMissileLauncher},
+}
+
+// makeWeapon creates the named Weapon.
+func makeWeapon(name string) Weapon {
+	for _, t := range weaponTypes {
+		if t.name == name {
+			return t.make()
+		}
+	}
+	panic(fmt.Sprintf("Unknown weapon %q", name))
+}
+
+// knownWeapon reports whether there is a Weapon with the name.
+func knownWeapon(name string) bool {
+	for _, t := range weaponTypes {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Gun is a Weapon that fires a pattern of projectiles. Its projectile factory decides what they are.
+type Gun struct {
+	name        string
+	cooldown    float64   // Seconds between shots. Halved by the rapidFire PowerUp.
+	maxShots    int       // Limit on this Gun's projectiles alive at once. 0 for no limit.
+	ammo        int       // Shots left. -1 for unlimited.
+	heatPerShot float64   // Heat added per shot. At 1 the Gun overheats until it has fully cooled.
+	coolRate    float64   // Heat lost per second.
+	spread      []float64 // Angle of each projectile in a shot, relative to the Ship's heading.
+	projectile  func(ship *Ship, direction pixel.Vec) Actor
+
+	timer      float64
+	heat       float64
+	overheated bool
+	live       []Actor
+}
+
+// makeSingleShot is the arcade original: one shot at a time and no more than four on screen.
+func makeSingleShot() Weapon {
+	return &Gun{name: "single", cooldown: 0.1, maxShots: 4, ammo: -1, spread: []float64{0}, projectile: fireShot}
+}
+
+func makeSpreadShot() Weapon {
+	return &Gun{name: "spread", cooldown: 0.15, maxShots: 12, ammo: -1, spread: []float64{-0.2, 0, 0.2},
+		projectile: fireShot}
+}
+
+// makeLaser fires a beam that instantly hits the first Rock in its path, but overheats quickly.
+func makeLaser() Weapon {
+	return &Gun{name: "laser", cooldown: 0.08, ammo: -1, heatPerShot: 0.08, coolRate: 0.4, spread: []float64{0},
+		projectile: fireLaserBeam}
+}
+
+func makeMissileLauncher() Weapon {
+	return &Gun{name: "missiles", cooldown: 0.4, maxShots: 2, ammo: 10, spread: []float64{0}, projectile: fireMissile}
+}
+
+func (g *Gun) Name() string {
+	return g.name
+}
+
+func (g *Gun) Update(dt float64) {
+	g.timer -= dt
+	g.heat = math.Max(0, g.heat-g.coolRate*dt)
+	if g.heat == 0 {
+		g.overheated = false
+	}
+}
+
+func (g *Gun) Fire(ship *Ship) {
+	if g.timer > 0 || g.overheated || g.ammo == 0 {
+		return
+	}
+
+	// Forget projectiles that are gone before checking the on-screen limit.
+	live := g.live[:0]
+	for _, projectile := range g.live {
+		if ship.stage.HasActor(projectile) {
+			live = append(live, projectile)
+		}
+	}
+	g.live = live
+	if g.maxShots > 0 && len(g.live)+len(g.spread) > g.maxShots {
+		return
+	}
+
+	g.timer = g.cooldown
+	if ship.hasPowerUp("rapidFire") {
+		g.timer /= 2
+	}
+	if g.ammo > 0 {
+		g.ammo--
+	}
+	g.heat += g.heatPerShot
+	if g.heat >= 1 {
+		g.overheated = true
+	}
+
+	for _, angle := range g.spread {
+		direction := pixel.Unit(ship.rotation + math.Pi/2 + angle)
+		projectile := g.projectile(ship, direction)
+		g.live = append(g.live, projectile)
+		ship.game.events.PublishShotFired(ShotFired{Ship: ship, Weapon: g.name, Projectile: projectile})
+	}
+}
+
+func (g *Gun) Depleted() bool {
+	return g.ammo == 0
+}
+
+func (g *Gun) Status() string {
+	switch {
+	case g.overheated:
+		return fmt.Sprintf("%v OVERHEATED", g.name)
+	case g.heatPerShot > 0:
+		return fmt.Sprintf("%v %v%%", g.name, int(g.heat*100))
+	case g.ammo >= 0:
+		return fmt.Sprintf("%v %v", g.name, g.ammo)
+	}
+	return ""
+}
+
+// fireShot launches a Shot from the Ship's nose.
+func fireShot(ship *Ship, direction pixel.Vec) Actor {
+	position := ship.position.Add(direction.Scaled(25))
+	velocity := ship.velocity.Add(direction.Scaled(5))
+	shot := makeShot(position, velocity, ship.stage, ship.game)
+	shot.shooter = ship
+	if ship.hasPowerUp("piercingShots") {
+		shot.pierce = 3
+	}
+	return shot
+}
+
+func fireLaserBeam(ship *Ship, direction pixel.Vec) Actor {
+	return makeLaserBeam(ship, ship.position.Add(direction.Scaled(25)), direction)
+}
+
+func fireMissile(ship *Ship, direction pixel.Vec) Actor {
+	return makeMissile(ship, ship.position.Add(direction.Scaled(25)), ship.velocity.Add(direction.Scaled(2)))
+}
+
+// LaserBeam is the flash left by a laser shot. The damage is done the moment it is created.
+type LaserBeam struct {
+	BaseActor
+	shooter *Ship
+	end     pixel.Vec
+	timeout float64
+	imd     *imdraw.IMDraw
+}
+
+const laserRange = 600.0
+
+func makeLaserBeam(ship *Ship, origin pixel.Vec, direction pixel.Vec) *LaserBeam {
+	stage := ship.stage
+	b := LaserBeam{BaseActor: MakeBaseActor(stage, "beam"), shooter: ship, timeout: 0.05, imd: imdraw.New(nil)}
+	b.position = origin
+	b.end = origin.Add(direction.Scaled(laserRange))
+
+	// The beam's "velocity" is only used as the impact it imparts on Rock pieces. It doesn't move.
+	b.velocity = direction.Scaled(5)
+
+	stage.AddActor(&b)
+
+	kinds := []string{"rock"}
+	if ship.game.friendlyFire {
+		kinds = append(kinds, "ship")
+	}
+	for _, hit := range stage.Raycast(origin, direction, laserRange, kinds...) {
+		switch target := hit.Actor.(type) {
+		case *Rock:
+			target.subdivide(&b)
+		case *Ship:
+			if target == ship || target.hyperspaceTimer > 0 {
+				continue
+			}
+			target.hit(&b)
+		}
+		b.end = hit.Point
+		break
+	}
+	return &b
+}
+
+func (b *LaserBeam) Shooter() *Ship {
+	return b.shooter
+}
+
+// Update fades the beam out.
+func (b *LaserBeam) Update(dt float64) {
+	b.timeout -= dt
+	if b.timeout < 0 {
+		b.stage.RemoveActor(b)
+	}
+}
+
+func (b *LaserBeam) Draw() {
+	b.imd.Clear()
+	b.imd.Color = colornames.Red
+	b.imd.Push(b.position, b.end)
+	b.imd.Line(2)
+	b.imd.Draw(b.stage.win)
+}
+
+// Missile homes in on the nearest Rock.
+type Missile struct {
+	WrapAroundActor
+	game     *Game
+	shooter  *Ship
+	timeout  float64
+	speed    float64
+	turnRate float64 // Radians per second.
+}
+
+func makeMissile(ship *Ship, position pixel.Vec, velocity pixel.Vec) *Missile {
+	stage := ship.stage
+	m := Missile{WrapAroundActor: makeWrapAroundActor(6, stage, "missile"), game: ship.game,
+		shooter: ship, timeout: 3, speed: 4, turnRate: 3}
+	m.position = position
+	m.velocity = velocity.Unit().Scaled(m.speed)
+	m.scale = 0.7
+	m.rotation = velocity.Angle()
+
+	stage.AddActor(&m)
+	return &m
+}
+
+// Shooter returns the Ship that fired the missile.
+func (m *Missile) Shooter() *Ship {
+	return m.shooter
+}
+
+// Update steers toward the nearest Rock and handles collision with it.
+func (m *Missile) Update(dt float64) {
+	stage := m.stage
+
+	m.timeout -= dt
+	if m.timeout < 0 {
+		stage.RemoveActor(m)
+		return
+	}
+
+	var target Actor
+	targetDist := math.MaxFloat64
+	for it := stage.Query(enemies); it.Next(); {
+		if dist := stage.WorldPosition(it.Actor()).Sub(m.position).Len(); dist < targetDist {
+			target = it.Actor()
+			targetDist = dist
+		}
+	}
+	if target != nil {
+		desired := stage.WorldPosition(target).Sub(m.position).Angle()
+		turn := math.Remainder(desired-m.velocity.Angle(), math.Pi*2)
+		turn = math.Max(-m.turnRate*dt, math.Min(m.turnRate*dt, turn))
+		m.velocity = m.velocity.Rotated(turn)
+	}
+	m.rotation = m.velocity.Angle()
+
+	m.WrapAroundActor.Update(dt)
+
+	if ship := friendlyFireTarget(m.game, m, m.shooter); ship != nil {
+		stage.RemoveActor(m)
+		ship.hit(m)
+		return
+	}
+	for _, actor := range stage.FindActorsByKind("rock") {
+		if intersects(actor, m) {
+			stage.RemoveActor(m)
+			actor.(*Rock).subdivide(m)
+			break
+		}
+	}
+}
+
+// WeaponStatus displays the status of a player's Weapon, e.g. remaining ammo or heat.
+type WeaponStatus struct {
+	TextActor
+	game   *Game
+	player *Player
+}
+
+func makeWeaponStatus(game *Game, player *Player) *WeaponStatus {
+	stage := game.stage
+	position := pixel.V(stage.bounds.Min.X+10, stage.bounds.Min.Y+10)
+	if len(game.players) > 1 {
+		position.X = game.hudColumn(player) - 50
+	}
+	w := WeaponStatus{TextActor: MakeTextActor(position, stage), game: game, player: player}
+
+	stage.AddActor(&w)
+	return &w
+}
+
+// Update the text with the status of the Weapon of the player's ship.
+func (a *WeaponStatus) Update(dt float64) {
+	status := ""
+	if a.player.hasShip() {
+		status = a.player.ship.weapon.Status()
+	}
+	if status != a.text {
+		a.SetText(status)
+	}
+	a.TextActor.Update(dt)
+}